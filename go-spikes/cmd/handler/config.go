@@ -24,7 +24,7 @@ func GetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cfg := configManager.Get()
+	cfg := configManager.Get().Redacted()
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(cfg); err != nil {
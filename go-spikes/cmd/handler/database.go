@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/infra-bed/go-spikes/pkg/infra/dbload"
+	"github.com/infra-bed/go-spikes/pkg/infra/mysql"
+	"github.com/infra-bed/go-spikes/pkg/infra/postgres"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+// MySQLLoad starts a job running the mysqlLoad mix of operations against database.mysql.
+func MySQLLoad(w http.ResponseWriter, r *http.Request) {
+	loadJob, err := mysql.NewLoadJob(r.Context(), configManager.GetDatabase().MySQL, configManager.GetTests().MySQLLoad)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create mysql load job")
+		http.Error(w, "Failed to create mysql load job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	startLoadJob(w, loadJob)
+}
+
+// PostgresLoad starts a job running the postgresLoad mix of operations against database.postgres,
+// through the target query parameter ("direct" or "pooler") or else postgresLoad.target.
+func PostgresLoad(w http.ResponseWriter, r *http.Request) {
+	loadCfg := configManager.GetTests().PostgresLoad
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = loadCfg.Target
+	}
+	loadJob, err := postgres.NewLoadJob(r.Context(), configManager.GetDatabase().Postgres, loadCfg, target)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create postgres load job")
+		http.Error(w, "Failed to create postgres load job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	startLoadJob(w, loadJob)
+}
+
+// startLoadJob runs a database load job, closing its pool once it has finished.
+func startLoadJob(w http.ResponseWriter, loadJob *dbload.Job) {
+	jobType := loadJob.GetPlugin().GetName()
+	metrics.ActiveJobs.WithLabelValues(jobType).Inc()
+	metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
+	runner := model.NewRunner()
+	execId := runner.Start(context.Background(), loadJob)
+	go func() {
+		runner.Wait()
+		loadJob.Close()
+	}()
+
+	stats := loadJob.Stats()
+	var response = map[string]interface{}{
+		"jobs":       []string{jobType},
+		"executions": map[string]string{jobType: execId},
+		"database":   stats.Database,
+		"table":      stats.Table,
+		"startTime":  time.Now(),
+	}
+	if stats.Target != "" {
+		response["target"] = stats.Target
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/infra-bed/go-spikes/pkg/infra/kafka/entityrepo"
+)
+
+const (
+	defaultEntityPageSize = 100
+	maxEntityPageSize     = 1000
+)
+
+var (
+	// entityRepoView is the consumer plugin of the running entity-repo job, whose
+	// materialized state the /entity-repo endpoints serve
+	entityRepoViewMu sync.Mutex
+	entityRepoView   *entityrepo.ConsumerPlugin
+)
+
+func setEntityRepoView(consumerPlugin *entityrepo.ConsumerPlugin) {
+	entityRepoViewMu.Lock()
+	defer entityRepoViewMu.Unlock()
+	entityRepoView = consumerPlugin
+}
+
+// clearEntityRepoView stops serving consumerPlugin, unless a later job has replaced it.
+func clearEntityRepoView(consumerPlugin *entityrepo.ConsumerPlugin) {
+	entityRepoViewMu.Lock()
+	defer entityRepoViewMu.Unlock()
+	if entityRepoView == consumerPlugin {
+		entityRepoView = nil
+	}
+}
+
+func getEntityRepoView(w http.ResponseWriter) (*entityrepo.ConsumerPlugin, bool) {
+	entityRepoViewMu.Lock()
+	defer entityRepoViewMu.Unlock()
+	if entityRepoView == nil {
+		http.Error(w, "No entity-repo consumer is running", http.StatusNotFound)
+		return nil, false
+	}
+	return entityRepoView, true
+}
+
+// ListEntities returns a page of the running consumer's entities, ordered by id, as
+// selected by the `page` (from 1) and `pageSize` query parameters.
+func ListEntities(w http.ResponseWriter, r *http.Request) {
+	view, ok := getEntityRepoView(w)
+	if !ok {
+		return
+	}
+	page, ok := intQueryParam(w, r, "page", 1, 1, 0)
+	if !ok {
+		return
+	}
+	pageSize, ok := intQueryParam(w, r, "pageSize", defaultEntityPageSize, 1, maxEntityPageSize)
+	if !ok {
+		return
+	}
+	writeJSON(w, view.Entities(page, pageSize))
+}
+
+// GetEntity returns the running consumer's state of one entity.
+func GetEntity(w http.ResponseWriter, r *http.Request) {
+	view, ok := getEntityRepoView(w)
+	if !ok {
+		return
+	}
+	entity, ok := view.Entity(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Entity not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, entity)
+}
+
+// GetEntityStats returns the statistics of the running consumer's materialized view.
+func GetEntityStats(w http.ResponseWriter, r *http.Request) {
+	view, ok := getEntityRepoView(w)
+	if !ok {
+		return
+	}
+	writeJSON(w, view.Stats())
+}
+
+// intQueryParam parses an optional integer query parameter of at least minValue and,
+// when maxValue is positive, at most maxValue.
+func intQueryParam(w http.ResponseWriter, r *http.Request, name string, defaultValue, minValue, maxValue int) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < minValue || (maxValue > 0 && value > maxValue) {
+		http.Error(w, "Invalid "+name, http.StatusBadRequest)
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+func ListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"executions": model.ExecutionRepo.ListExecutions(),
+	})
+}
+
+// GetJob returns the execution and, for jobs that report one, its result.
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	execution, ok := getExecution(w, r)
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{
+		"execution": execution,
+	}
+	if reporter, ok := execution.Job.(model.ResultReporter); ok {
+		response["result"] = reporter.GetResult()
+	}
+	writeJSON(w, response)
+}
+
+// GetJobAssignment returns the partitions currently assigned to a running consumer job.
+func GetJobAssignment(w http.ResponseWriter, r *http.Request) {
+	execution, ok := getExecution(w, r)
+	if !ok {
+		return
+	}
+
+	reporter, ok := execution.Job.(infra.AssignmentReporter)
+	if !ok {
+		http.Error(w, "Job has no partition assignment", http.StatusBadRequest)
+		return
+	}
+	if !execution.Running {
+		http.Error(w, "Job is no longer running", http.StatusConflict)
+		return
+	}
+	assignment, err := reporter.GetAssignment()
+	if err != nil {
+		logger.Get().Error().Err(err).Str("id", execution.ID).Msg("Failed to get assignment")
+		http.Error(w, "Failed to get assignment", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":         execution.ID,
+		"jobName":    execution.JobName,
+		"assignment": assignment,
+	})
+}
+
+const seekTimeout = 30 * time.Second
+
+// SeekJob rewinds or fast-forwards every partition assigned to a running consumer job.
+// The body is a start position, e.g. {"position":"timestamp","timestamp":"2025-01-01T00:00:00Z"}.
+func SeekJob(w http.ResponseWriter, r *http.Request) {
+	execution, ok := getExecution(w, r)
+	if !ok {
+		return
+	}
+
+	seeker, ok := execution.Job.(infra.Seeker)
+	if !ok {
+		http.Error(w, "Job does not support seeking", http.StatusBadRequest)
+		return
+	}
+	if !execution.Running {
+		http.Error(w, "Job is no longer running", http.StatusConflict)
+		return
+	}
+	var position cfg.StartPosition
+	if err := json.NewDecoder(r.Body).Decode(&position); err != nil {
+		http.Error(w, "Invalid seek position", http.StatusBadRequest)
+		return
+	}
+	if err := position.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), seekTimeout)
+	defer cancel()
+	partitions, err := seeker.Seek(ctx, position)
+	if err != nil {
+		logger.Get().Error().Err(err).Str("id", execution.ID).Msg("Failed to seek job")
+		http.Error(w, "Failed to seek: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":         execution.ID,
+		"jobName":    execution.JobName,
+		"position":   position,
+		"partitions": partitions,
+	})
+}
+
+// ScaleJobMembers changes the number of members of a running consumer group job, e.g.
+// {"members":4}, and responds once the group has settled.
+func ScaleJobMembers(w http.ResponseWriter, r *http.Request) {
+	execution, ok := getExecution(w, r)
+	if !ok {
+		return
+	}
+
+	scaler, ok := execution.Job.(infra.GroupScaler)
+	if !ok {
+		http.Error(w, "Job is not a consumer group job", http.StatusBadRequest)
+		return
+	}
+	if !execution.Running {
+		http.Error(w, "Job is no longer running", http.StatusConflict)
+		return
+	}
+	var request struct {
+		Members int `json:"members"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid members request", http.StatusBadRequest)
+		return
+	}
+
+	event, err := scaler.ScaleTo(r.Context(), request.Members)
+	if err != nil {
+		logger.Get().Error().Err(err).Str("id", execution.ID).Msg("Failed to scale job")
+		http.Error(w, "Failed to scale: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":      execution.ID,
+		"jobName": execution.JobName,
+		"event":   event,
+	})
+}
+
+func getExecution(w http.ResponseWriter, r *http.Request) (model.JobExecution, bool) {
+	id := mux.Vars(r)["id"]
+	execution, ok := model.ExecutionRepo.Get(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+	}
+	return execution, ok
+}
+
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+	}
+}
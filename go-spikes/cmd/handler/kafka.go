@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"slices"
 	"time"
 
 	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
 	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
 	"github.com/infra-bed/go-spikes/pkg/infra/kafka/entityrepo"
+	"github.com/infra-bed/go-spikes/pkg/infra/sqlsink"
 	"github.com/infra-bed/go-spikes/pkg/logger"
 	"github.com/infra-bed/go-spikes/pkg/metrics"
 	"github.com/infra-bed/go-spikes/pkg/model"
@@ -23,18 +25,69 @@ func EntityRepoTest(w http.ResponseWriter, r *http.Request) {
 
 	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
 
-	if producerJob, err = infra.NewProducerJob[entityrepo.Payload](
-		kConfig,
-		entityrepo.NewProducerPlugin(testConfig.PluginsConfig.ProducerPluginConfig),
-	); err != nil {
+	var topicAdmin infra.TopicAdmin
+	var topics []string
+	if testConfig.TopicSpec.Enabled {
+		if topicAdmin, err = infra.NewTopicAdmin(kConfig); err != nil {
+			logger.Get().Error().Err(err).Msg("Failed to create topic admin")
+			http.Error(w, "Failed to create topic admin", http.StatusInternalServerError)
+			return
+		}
+		// the producer writes to the topic, which the consumer may not subscribe to; the
+		// topics matched by patterns, and their retry and DLQ topics, are left alone
+		candidates := append([]string{kConfig.Topic}, kConfig.SubscriptionTopics()...)
+		if kConfig.ConsumerConfig.DeadLetter.Enabled {
+			for tier := range kConfig.ConsumerConfig.DeadLetter.RetryDelays {
+				candidates = append(candidates, kConfig.RetryTopics(tier+1)...)
+			}
+			candidates = append(candidates, kConfig.DeadLetterTopics()...)
+		}
+		for _, topic := range candidates {
+			if !cfg.IsTopicPattern(topic) && !slices.Contains(topics, topic) {
+				topics = append(topics, topic)
+			}
+		}
+		for _, topic := range topics {
+			if err = topicAdmin.EnsureTopic(r.Context(), topic, testConfig.TopicSpec); err != nil {
+				topicAdmin.Close()
+				logger.Get().Error().Err(err).Str("topic", topic).Msg("Failed to ensure topic")
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	producerPlugin := entityrepo.NewProducerPlugin(testConfig.PluginsConfig.ProducerPluginConfig)
+	consumerPlugin, err := entityrepo.NewConsumerPlugin(testConfig.PluginsConfig.ConsumerPluginConfig)
+	if err != nil {
+		closeTopicAdmin(topicAdmin)
+		logger.Get().Error().Err(err).Msg("Failed to create consumer plugin")
+		http.Error(w, "Failed to create consumer plugin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	consumerPlugin.CrossCheck(producerPlugin)
+	resumeFromStateStore(&kConfig, consumerPlugin)
+	if err = attachSink(r.Context(), &kConfig, consumerPlugin, testConfig.PluginsConfig.ConsumerPluginConfig.Sink); err != nil {
+		closeConsumerPlugin(consumerPlugin)
+		closeTopicAdmin(topicAdmin)
+		logger.Get().Error().Err(err).Msg("Failed to create sink")
+		http.Error(w, "Failed to create sink: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setEntityRepoView(consumerPlugin)
+
+	if producerJob, err = infra.NewProducerJob[entityrepo.Payload](kConfig, producerPlugin); err != nil {
+		closeConsumerPlugin(consumerPlugin)
+		closeTopicAdmin(topicAdmin)
 		logger.Get().Error().Err(err).Msg("Failed to create producer engine")
 		http.Error(w, "Failed to create producer engine", http.StatusInternalServerError)
 		return
 	}
 
-	if consumerJob, err = infra.NewConsumerJob[entityrepo.Payload](kConfig, entityrepo.NewConsumerPlugin(
-		testConfig.PluginsConfig.ConsumerPluginConfig,
-	)); err != nil {
+	if consumerJob, err = infra.NewConsumerJob[entityrepo.Payload](kConfig, consumerPlugin); err != nil {
+		producerJob.Close()
+		closeConsumerPlugin(consumerPlugin)
+		closeTopicAdmin(topicAdmin)
 		logger.Get().Error().Err(err).Msg("Failed to create consumer engine")
 		http.Error(w, "Failed to create consumer engine", http.StatusInternalServerError)
 		return
@@ -44,19 +97,186 @@ func EntityRepoTest(w http.ResponseWriter, r *http.Request) {
 	jobs := []model.Job{producerJob, consumerJob}
 
 	// Track active jobs
+	executions := make(map[string]string)
 	for _, job := range jobs {
 		jobType := job.GetPlugin().GetName()
 		metrics.ActiveJobs.WithLabelValues(jobType).Inc()
 		metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
-		runner.Start(context.Background(), job)
+		executions[jobType] = runner.Start(context.Background(), job)
 	}
 
+	go func() {
+		runner.Wait()
+
+		stateCheck := entityrepo.VerifyMaterializedState(producerPlugin, consumerPlugin)
+		event, outcome := logger.Get().Info(), "passed"
+		if stateCheck.Skipped != "" {
+			outcome = "skipped"
+		} else if !stateCheck.Matches {
+			event, outcome = logger.Get().Warn(), "failed"
+		}
+		event.Any("stateCheck", stateCheck).Msg("entity-repo convergence check " + outcome)
+
+		sequenceReport := consumerPlugin.SequenceReport()
+		event = logger.Get().Info()
+		if !sequenceReport.Clean {
+			event = logger.Get().Warn()
+		}
+		event.Any("sequenceReport", sequenceReport).Msg("entity-repo loss, duplication and ordering check")
+
+		schemaReport := consumerPlugin.SchemaReport()
+		event = logger.Get().Info()
+		if schemaReport.Incompatible > 0 {
+			event = logger.Get().Warn()
+		}
+		event.Any("schemaReport", schemaReport).Msg("entity-repo payload versions")
+		closeConsumerPlugin(consumerPlugin)
+
+		if topicAdmin != nil {
+			defer topicAdmin.Close()
+			for _, topic := range topics {
+				if err := topicAdmin.FinishTopic(context.Background(), topic, testConfig.TopicSpec); err != nil {
+					logger.Get().Error().Err(err).Str("topic", topic).Msg("Failed to finish topic")
+				}
+			}
+		}
+	}()
+
 	var response = map[string]interface{}{
 		"jobs": []string{
 			producerJob.GetPlugin().GetName(),
 			consumerJob.GetPlugin().GetName(),
 		},
-		"startTime": time.Now(),
+		"executions": executions,
+		"startTime":  time.Now(),
+	}
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// closeTopicAdmin closes the topic admin of a test that failed to start, if it has one.
+func closeTopicAdmin(topicAdmin infra.TopicAdmin) {
+	if topicAdmin != nil {
+		topicAdmin.Close()
+	}
+}
+
+// KafkaTopics describes the topics given by the repeatable `topic` query parameter,
+// or every topic on the entity-repo cluster when none are given.
+func KafkaTopics(w http.ResponseWriter, r *http.Request) {
+	testConfig := configManager.GetTests().EntityRepoConfig
+	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
+
+	topicAdmin, err := infra.NewTopicAdmin(kConfig)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create topic admin")
+		http.Error(w, "Failed to create topic admin", http.StatusInternalServerError)
+		return
+	}
+	defer topicAdmin.Close()
+
+	descriptions, err := topicAdmin.DescribeTopics(r.Context(), r.URL.Query()["topic"])
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to describe topics")
+		http.Error(w, "Failed to describe topics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(map[string]interface{}{"topics": descriptions}); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// EntityRepoGroupScale starts an in-process consumer group of entity-repo consumers,
+// scaled as configured in groupScale and through POST /jobs/{id}/members.
+func EntityRepoGroupScale(w http.ResponseWriter, r *http.Request) {
+	testConfig := configManager.GetTests().EntityRepoConfig
+	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
+
+	consumerPlugin, err := entityrepo.NewConsumerPlugin(testConfig.PluginsConfig.ConsumerPluginConfig)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create consumer plugin")
+		http.Error(w, "Failed to create consumer plugin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resumeFromStateStore(&kConfig, consumerPlugin)
+	if err = attachSink(r.Context(), &kConfig, consumerPlugin, testConfig.PluginsConfig.ConsumerPluginConfig.Sink); err != nil {
+		closeConsumerPlugin(consumerPlugin)
+		logger.Get().Error().Err(err).Msg("Failed to create sink")
+		http.Error(w, "Failed to create sink: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setEntityRepoView(consumerPlugin)
+	groupJob, err := infra.NewConsumerGroupJob[entityrepo.Payload](
+		kConfig,
+		testConfig.GroupScale,
+		infra.NewJobPlugin(testConfig.PluginsConfig.GroupScalePluginConfig),
+		consumerPlugin,
+	)
+	if err != nil {
+		closeConsumerPlugin(consumerPlugin)
+		logger.Get().Error().Err(err).Msg("Failed to create consumer group job")
+		http.Error(w, "Failed to create consumer group job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobType := groupJob.GetPlugin().GetName()
+	metrics.ActiveJobs.WithLabelValues(jobType).Inc()
+	metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
+	runner := model.NewRunner()
+	execId := runner.Start(context.Background(), groupJob)
+	go func() {
+		runner.Wait()
+		closeConsumerPlugin(consumerPlugin)
+	}()
+
+	var response = map[string]interface{}{
+		"jobs":       []string{jobType},
+		"executions": map[string]string{jobType: execId},
+		"group":      kConfig.ConsumerConfig.ConsumerGroup,
+		"members":    testConfig.GroupScale.Members,
+		"startTime":  time.Now(),
+	}
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// EntityRepoDeadLetterReplay starts a job that republishes the entity-repo DLQ to its original topic.
+func EntityRepoDeadLetterReplay(w http.ResponseWriter, r *http.Request) {
+	testConfig := configManager.GetTests().EntityRepoConfig
+	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
+
+	replayJob, err := infra.NewDeadLetterReplayJob(
+		kConfig,
+		infra.NewJobPlugin(testConfig.PluginsConfig.DeadLetterReplayPluginConfig),
+	)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create dead letter replay job")
+		http.Error(w, "Failed to create dead letter replay job", http.StatusInternalServerError)
+		return
+	}
+
+	jobType := replayJob.GetPlugin().GetName()
+	metrics.ActiveJobs.WithLabelValues(jobType).Inc()
+	metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
+	execId := model.NewRunner().Start(context.Background(), replayJob)
+
+	var response = map[string]interface{}{
+		"jobs":       []string{jobType},
+		"executions": map[string]string{jobType: execId},
+		"topics":     kConfig.DeadLetterTopics(),
+		"startTime":  time.Now(),
 	}
 
 	if err = json.NewEncoder(w).Encode(response); err != nil {
@@ -65,3 +285,47 @@ func EntityRepoTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// resumeFromStateStore starts the consumer from the offsets of a restored state store, so
+// that messages already in the materialized view are not applied again. Offsets of topics
+// the consumer no longer subscribes to are left out; those stored without a topic belong
+// to the default topic.
+func resumeFromStateStore(kConfig *cfg.KafkaConfig, consumerPlugin *entityrepo.ConsumerPlugin) {
+	var offsets []cfg.PartitionOffset
+	for _, offset := range consumerPlugin.StoredOffsets() {
+		topic := offset.Topic
+		if topic == "" {
+			topic = kConfig.Topic
+		}
+		if kConfig.Subscribes(topic) {
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) == 0 {
+		return
+	}
+	kConfig.ConsumerConfig.StartFrom = cfg.StartPosition{Position: cfg.StartFromOffsets, Offsets: offsets}
+	logger.Get().Info().Any("offsets", offsets).Msg("Resuming entity-repo consumer from its state store")
+}
+
+// attachSink connects the consumer to its database sink, if one is enabled, and batches
+// its messages as the sink is configured to write them.
+func attachSink(ctx context.Context, kConfig *cfg.KafkaConfig, consumerPlugin *entityrepo.ConsumerPlugin, sinkConfig cfg.SQLSinkConfig) error {
+	if !sinkConfig.Enabled {
+		return nil
+	}
+	sink, err := sqlsink.New(ctx, sinkConfig, configManager.GetDatabase())
+	if err != nil {
+		return err
+	}
+	consumerPlugin.SinkTo(sink)
+	kConfig.ConsumerConfig.Batch = sinkConfig.BatchConfig()
+	return nil
+}
+
+func closeConsumerPlugin(consumerPlugin *entityrepo.ConsumerPlugin) {
+	clearEntityRepoView(consumerPlugin)
+	if err := consumerPlugin.Close(); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to close entity-repo state store")
+	}
+}
@@ -43,12 +43,44 @@ func extractEndpoint(path string) string {
 		return "/cpu/fibonacci/{n}"
 	case strings.HasPrefix(path, "/config/feature/"):
 		return "/config/feature/{feature}"
+	case strings.HasPrefix(path, "/jobs/") && strings.HasSuffix(path, "/assignment"):
+		return "/jobs/{id}/assignment"
+	case strings.HasPrefix(path, "/jobs/") && strings.HasSuffix(path, "/seek"):
+		return "/jobs/{id}/seek"
+	case strings.HasPrefix(path, "/jobs/") && strings.HasSuffix(path, "/members"):
+		return "/jobs/{id}/members"
+	case strings.HasPrefix(path, "/jobs/"):
+		return "/jobs/{id}"
+	case strings.HasPrefix(path, "/entity-repo/entities/"):
+		return "/entity-repo/entities/{id}"
+	case path == "/entity-repo/entities":
+		return "/entity-repo/entities"
+	case path == "/entity-repo/stats":
+		return "/entity-repo/stats"
+	case path == "/jobs":
+		return "/jobs"
 	case path == "/health":
 		return "/health"
 	case path == "/config":
 		return "/config"
 	case path == "/kafka/entity-repo":
 		return "/kafka/entity-repo"
+	case path == "/kafka/entity-repo/dlq/replay":
+		return "/kafka/entity-repo/dlq/replay"
+	case path == "/kafka/entity-repo/group-scale":
+		return "/kafka/entity-repo/group-scale"
+	case path == "/kafka/topics":
+		return "/kafka/topics"
+	case path == "/kafka/outbox":
+		return "/kafka/outbox"
+	case path == "/kafka/capture":
+		return "/kafka/capture"
+	case path == "/kafka/replay":
+		return "/kafka/replay"
+	case path == "/db/mysql/load":
+		return "/db/mysql/load"
+	case path == "/db/postgres/load":
+		return "/db/postgres/load"
 	case path == "/metrics":
 		return "/metrics"
 	default:
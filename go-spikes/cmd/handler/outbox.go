@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/infra/kafka/outbox"
+	"github.com/infra-bed/go-spikes/pkg/infra/postgres"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+// OutboxTest starts the transactional outbox spike: a writer of entities and outbox
+// events, a relay producing the events to Kafka, and a verifier consuming them. Once all
+// three have finished, lost and duplicated events are reported.
+func OutboxTest(w http.ResponseWriter, r *http.Request) {
+	testConfig := configManager.GetTests().OutboxConfig
+	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
+
+	pool, err := postgres.NewPool(r.Context(), configManager.GetDatabase().Postgres)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to connect to postgres")
+		http.Error(w, "Failed to connect to postgres: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	spike, err := outbox.NewSpike(r.Context(), pool, kConfig, testConfig)
+	if err != nil {
+		pool.Close()
+		logger.Get().Error().Err(err).Msg("Failed to create outbox spike")
+		http.Error(w, "Failed to create outbox spike: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	verifierJob, err := infra.NewConsumerJob[outbox.Event](kConfig, spike.Verifier)
+	if err != nil {
+		pool.Close()
+		logger.Get().Error().Err(err).Msg("Failed to create consumer engine")
+		http.Error(w, "Failed to create consumer engine", http.StatusInternalServerError)
+		return
+	}
+
+	runner := model.NewRunner()
+	jobs := []model.Job{spike.Writer, spike.Relay, verifierJob}
+	executions := make(map[string]string)
+	jobNames := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		jobType := job.GetPlugin().GetName()
+		metrics.ActiveJobs.WithLabelValues(jobType).Inc()
+		metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
+		executions[jobType] = runner.Start(context.Background(), job)
+		jobNames = append(jobNames, jobType)
+	}
+
+	go func() {
+		runner.Wait()
+		defer pool.Close()
+
+		report, err := spike.Verify(context.Background())
+		if err != nil {
+			logger.Get().Error().Err(err).Msg("Failed to verify outbox events")
+			return
+		}
+		event, outcome := logger.Get().Info(), "passed"
+		if !report.Lossless || !report.DuplicateFree {
+			event, outcome = logger.Get().Warn(), "failed"
+		}
+		event.Any("outboxReport", report).Msg("outbox loss and duplication check " + outcome)
+	}()
+
+	var response = map[string]interface{}{
+		"jobs":       jobNames,
+		"executions": executions,
+		"runId":      spike.Writer.RunID(),
+		"startTime":  time.Now(),
+	}
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
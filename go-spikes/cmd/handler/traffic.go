@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/infra/kafka/traffic"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+// TrafficCapture starts a job that records the traffic topic to rotating JSONL files.
+func TrafficCapture(w http.ResponseWriter, r *http.Request) {
+	testConfig := configManager.GetTests().TrafficConfig
+	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
+
+	capturePlugin, err := traffic.NewCapturePlugin(testConfig.Capture, kConfig.Topic)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create capture plugin")
+		http.Error(w, "Failed to create capture plugin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	captureJob, err := infra.NewConsumerJob[traffic.Record](kConfig, capturePlugin)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create consumer engine")
+		http.Error(w, "Failed to create consumer engine", http.StatusInternalServerError)
+		return
+	}
+
+	jobType := captureJob.GetPlugin().GetName()
+	metrics.ActiveJobs.WithLabelValues(jobType).Inc()
+	metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
+	runner := model.NewRunner()
+	execId := runner.Start(context.Background(), captureJob)
+	go func() {
+		runner.Wait()
+		if err := capturePlugin.Close(); err != nil {
+			logger.Get().Error().Err(err).Msg("Failed to close capture file")
+		}
+		logger.Get().Info().Any("captureStats", capturePlugin.Stats()).Msg("Finished capturing traffic")
+	}()
+
+	var response = map[string]interface{}{
+		"jobs":       []string{jobType},
+		"executions": map[string]string{jobType: execId},
+		"topic":      kConfig.Topic,
+		"dir":        testConfig.Capture.Dir,
+		"startTime":  time.Now(),
+	}
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// TrafficReplay starts a job that produces recorded traffic to the traffic topic.
+func TrafficReplay(w http.ResponseWriter, r *http.Request) {
+	testConfig := configManager.GetTests().TrafficConfig
+	kConfig := cfg.ApplyKafkaConfigOverrides(configManager.GetKafka(), testConfig.KafkaOverrides)
+
+	replayPlugin, err := traffic.NewReplayPlugin(testConfig.Replay)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create replay plugin")
+		http.Error(w, "Failed to create replay plugin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	replayJob, err := infra.NewProducerJob[traffic.Record](kConfig, replayPlugin)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to create producer engine")
+		http.Error(w, "Failed to create producer engine", http.StatusInternalServerError)
+		return
+	}
+
+	jobType := replayJob.GetPlugin().GetName()
+	metrics.ActiveJobs.WithLabelValues(jobType).Inc()
+	metrics.JobExecutions.WithLabelValues(jobType, "started").Inc()
+	execId := model.NewRunner().Start(context.Background(), replayJob)
+
+	var response = map[string]interface{}{
+		"jobs":       []string{jobType},
+		"executions": map[string]string{jobType: execId},
+		"topic":      kConfig.Topic,
+		"files":      replayPlugin.Stats().Files,
+		"startTime":  time.Now(),
+	}
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -160,6 +160,22 @@ func main() {
 
 	r.HandleFunc("/cpu/fibonacci/{n}", handler.Fibonacci).Methods("GET")
 	r.HandleFunc("/kafka/entity-repo", handler.EntityRepoTest).Methods("GET")
+	r.HandleFunc("/kafka/entity-repo/dlq/replay", handler.EntityRepoDeadLetterReplay).Methods("POST")
+	r.HandleFunc("/kafka/entity-repo/group-scale", handler.EntityRepoGroupScale).Methods("POST")
+	r.HandleFunc("/kafka/topics", handler.KafkaTopics).Methods("GET")
+	r.HandleFunc("/kafka/outbox", handler.OutboxTest).Methods("POST")
+	r.HandleFunc("/kafka/capture", handler.TrafficCapture).Methods("POST")
+	r.HandleFunc("/kafka/replay", handler.TrafficReplay).Methods("POST")
+	r.HandleFunc("/db/mysql/load", handler.MySQLLoad).Methods("POST")
+	r.HandleFunc("/db/postgres/load", handler.PostgresLoad).Methods("POST")
+	r.HandleFunc("/entity-repo/entities", handler.ListEntities).Methods("GET")
+	r.HandleFunc("/entity-repo/entities/{id}", handler.GetEntity).Methods("GET")
+	r.HandleFunc("/entity-repo/stats", handler.GetEntityStats).Methods("GET")
+	r.HandleFunc("/jobs", handler.ListJobs).Methods("GET")
+	r.HandleFunc("/jobs/{id}", handler.GetJob).Methods("GET")
+	r.HandleFunc("/jobs/{id}/assignment", handler.GetJobAssignment).Methods("GET")
+	r.HandleFunc("/jobs/{id}/seek", handler.SeekJob).Methods("POST")
+	r.HandleFunc("/jobs/{id}/members", handler.ScaleJobMembers).Methods("POST")
 	r.HandleFunc("/config", handler.GetConfig).Methods("GET")
 	r.HandleFunc("/config/feature/{feature}", handler.CheckFeature).Methods("GET")
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -37,12 +38,16 @@ type DatabaseConfig struct {
 	Postgres PostgresConfig `mapstructure:"postgres"`
 }
 
+// MySQLConfig and PostgresConfig read the password from PasswordFile, a mounted secret,
+// and connect without one when it is empty. PostgresConfig's PoolerHost and PoolerPort
+// address the PgBouncer pooler in front of the cluster that Host and Port reach directly.
 type MySQLConfig struct {
 	Enabled         bool          `mapstructure:"enabled"`
 	Host            string        `mapstructure:"host"`
 	Port            int           `mapstructure:"port"`
 	Database        string        `mapstructure:"database"`
 	User            string        `mapstructure:"user"`
+	PasswordFile    string        `mapstructure:"passwordFile"`
 	MaxConnections  int           `mapstructure:"maxConnections"`
 	MaxIdleConns    int           `mapstructure:"maxIdleConns"`
 	ConnMaxLifetime time.Duration `mapstructure:"connMaxLifetime"`
@@ -54,12 +59,35 @@ type PostgresConfig struct {
 	Port            int           `mapstructure:"port"`
 	Database        string        `mapstructure:"database"`
 	User            string        `mapstructure:"user"`
+	PasswordFile    string        `mapstructure:"passwordFile"`
 	SSLMode         string        `mapstructure:"sslMode"`
+	PoolerHost      string        `mapstructure:"poolerHost"`
+	PoolerPort      int           `mapstructure:"poolerPort"`
 	MaxConnections  int           `mapstructure:"maxConnections"`
 	MaxIdleConns    int           `mapstructure:"maxIdleConns"`
 	ConnMaxLifetime time.Duration `mapstructure:"connMaxLifetime"`
 }
 
+func (mc MySQLConfig) Password() (string, error) {
+	return readPasswordFile(mc.PasswordFile)
+}
+
+func (pc PostgresConfig) Password() (string, error) {
+	return readPasswordFile(pc.PasswordFile)
+}
+
+// readPasswordFile reads a password from a mounted secret file; no file means no password.
+func readPasswordFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 type FeatureFlags struct {
 	EnableProfiling   bool            `mapstructure:"enableProfiling"`
 	EnableTracing     bool            `mapstructure:"enableTracing"`
@@ -76,6 +104,20 @@ type MetricsConfig struct {
 
 type TestsConfig struct {
 	EntityRepoConfig k.EntityRepoConfig `mapstructure:"entityRepo"`
+	OutboxConfig     k.OutboxConfig     `mapstructure:"outbox"`
+	TrafficConfig    k.TrafficConfig    `mapstructure:"traffic"`
+	MySQLLoad        LoadConfig         `mapstructure:"mysqlLoad"`
+	PostgresLoad     LoadConfig         `mapstructure:"postgresLoad"`
+}
+
+// Redacted returns a copy of the Config with credentials masked, for exposing over the API.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Kafka = c.Kafka.Redacted()
+	redacted.Tests.EntityRepoConfig = c.Tests.EntityRepoConfig.Redacted()
+	redacted.Tests.OutboxConfig = c.Tests.OutboxConfig.Redacted()
+	redacted.Tests.TrafficConfig = c.Tests.TrafficConfig.Redacted()
+	return &redacted
 }
 
 type ConfigManager struct {
@@ -253,6 +295,7 @@ func (cm *ConfigManager) setDefaultsForViper(v *viper.Viper) {
 	v.SetDefault("kafka.brokers", []string{"kafka-cluster-kafka-bootstrap.kafka:9092"})
 	v.SetDefault("kafka.topic", "test-topic")
 	v.SetDefault("kafka.consumerGroup", "go-spikes-consumer")
+	v.SetDefault("kafka.security.protocol", "PLAINTEXT")
 	v.SetDefault("kafka.producer.batchSize", 100)
 	v.SetDefault("kafka.producer.batchTimeout", "1s")
 	v.SetDefault("kafka.producer.compressionType", "snappy")
@@ -261,6 +304,7 @@ func (cm *ConfigManager) setDefaultsForViper(v *viper.Viper) {
 	v.SetDefault("kafka.consumer.heartbeatInterval", "3s")
 	v.SetDefault("kafka.consumer.maxPollRecords", 500)
 	v.SetDefault("kafka.consumer.autoOffsetReset", "latest")
+	v.SetDefault("kafka.consumer.lagInterval", "15s")
 
 	v.SetDefault("database.mysql.enabled", false)
 	v.SetDefault("database.mysql.host", "mycluster-router.default")
@@ -0,0 +1,36 @@
+package kafka
+
+const (
+	TopicOnFinishKeep     = ""
+	TopicOnFinishDelete   = "delete"
+	TopicOnFinishTruncate = "truncate"
+)
+
+// TopicSpec declares the shape a test expects its topic to have:
+// * Enabled - when false, the topic is used as-is and no admin calls are made
+// * Partitions - the number of partitions to create the topic with
+// * ReplicationFactor - the replication factor to create the topic with
+// * Configs - topic-level configs, e.g. cleanup.policy or min.insync.replicas
+// * OnFinish - what to do with the topic once the jobs finish: "" (keep), "delete" or "truncate"
+type TopicSpec struct {
+	Enabled           bool               `mapstructure:"enabled"`
+	Partitions        int                `mapstructure:"partitions"`
+	ReplicationFactor int                `mapstructure:"replicationFactor"`
+	Configs           []TopicConfigEntry `mapstructure:"configs"`
+	OnFinish          string             `mapstructure:"onFinish"`
+}
+
+// TopicConfigEntry is a single topic-level config. Entries are a list rather than
+// a map because viper splits dotted map keys such as cleanup.policy into nested maps.
+type TopicConfigEntry struct {
+	Name  string `mapstructure:"name"`
+	Value string `mapstructure:"value"`
+}
+
+func (s TopicSpec) ConfigMap() map[string]string {
+	configs := make(map[string]string, len(s.Configs))
+	for _, entry := range s.Configs {
+		configs[entry.Name] = entry.Value
+	}
+	return configs
+}
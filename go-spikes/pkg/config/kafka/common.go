@@ -1,14 +1,57 @@
 package kafka
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
 
 type KafkaConfig struct {
 	Brokers        []string       `mapstructure:"brokers"`
 	Topic          string         `mapstructure:"topic"`
+	Security       SecurityConfig `mapstructure:"security"`
 	ProducerConfig ProducerConfig `mapstructure:"producer"`
 	ConsumerConfig ConsumerConfig `mapstructure:"consumer"`
 }
 
+// SubscriptionTopics returns the topics and patterns a consumer subscribes to.
+func (kc KafkaConfig) SubscriptionTopics() []string {
+	if len(kc.ConsumerConfig.Topics) > 0 {
+		return kc.ConsumerConfig.Topics
+	}
+	return []string{kc.Topic}
+}
+
+// IsTopicPattern reports whether a subscription entry is a regular expression.
+func IsTopicPattern(topic string) bool {
+	return strings.HasPrefix(topic, "^")
+}
+
+// Subscribes reports whether a consumer of the config receives messages of topic, as one
+// of its topics or by matching one of its patterns.
+func (kc KafkaConfig) Subscribes(topic string) bool {
+	for _, subscribed := range kc.SubscriptionTopics() {
+		if !IsTopicPattern(subscribed) {
+			if subscribed == topic {
+				return true
+			}
+			continue
+		}
+		if pattern, err := regexp.Compile(subscribed); err == nil && pattern.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the KafkaConfig with its credentials masked.
+func (kc KafkaConfig) Redacted() KafkaConfig {
+	kc.Security = kc.Security.Redacted()
+	return kc
+}
+
 func ApplyKafkaConfigOverrides(kc KafkaConfig, overrides KafkaConfig) KafkaConfig {
 	if overrides.Brokers != nil {
 		kc.Brokers = overrides.Brokers
@@ -16,6 +59,7 @@ func ApplyKafkaConfigOverrides(kc KafkaConfig, overrides KafkaConfig) KafkaConfi
 	if overrides.Topic != "" {
 		kc.Topic = overrides.Topic
 	}
+	kc.Security = ApplySecurityConfigOverrides(kc.Security, overrides.Security)
 	if overrides.ProducerConfig.ClientId != "" {
 		kc.ProducerConfig.ClientId = overrides.ProducerConfig.ClientId
 	}
@@ -61,6 +105,36 @@ func ApplyKafkaConfigOverrides(kc KafkaConfig, overrides KafkaConfig) KafkaConfi
 	if overrides.ConsumerConfig.LogBatchSize > 0 {
 		kc.ConsumerConfig.LogBatchSize = overrides.ConsumerConfig.LogBatchSize
 	}
+	if overrides.ConsumerConfig.PartitionAssignmentStrategy != "" {
+		kc.ConsumerConfig.PartitionAssignmentStrategy = overrides.ConsumerConfig.PartitionAssignmentStrategy
+	}
+	if overrides.ConsumerConfig.LagInterval > 0 {
+		kc.ConsumerConfig.LagInterval = overrides.ConsumerConfig.LagInterval
+	}
+	if overrides.ConsumerConfig.Concurrency.Workers > 0 {
+		kc.ConsumerConfig.Concurrency = overrides.ConsumerConfig.Concurrency
+	}
+	if len(overrides.ConsumerConfig.Topics) > 0 {
+		kc.ConsumerConfig.Topics = overrides.ConsumerConfig.Topics
+	}
+	if len(overrides.ConsumerConfig.Routes) > 0 {
+		kc.ConsumerConfig.Routes = overrides.ConsumerConfig.Routes
+	}
+	if overrides.ConsumerConfig.TopicRefreshInterval > 0 {
+		kc.ConsumerConfig.TopicRefreshInterval = overrides.ConsumerConfig.TopicRefreshInterval
+	}
+	if overrides.ConsumerConfig.Commit.Strategy != "" {
+		kc.ConsumerConfig.Commit = overrides.ConsumerConfig.Commit
+	}
+	if overrides.ConsumerConfig.StartFrom.Position != "" {
+		kc.ConsumerConfig.StartFrom = overrides.ConsumerConfig.StartFrom
+	}
+	if overrides.ConsumerConfig.Batch.Enabled {
+		kc.ConsumerConfig.Batch = overrides.ConsumerConfig.Batch
+	}
+	if overrides.ConsumerConfig.DeadLetter.Enabled {
+		kc.ConsumerConfig.DeadLetter = overrides.ConsumerConfig.DeadLetter
+	}
 
 	return kc
 }
@@ -74,15 +148,115 @@ type ProducerConfig struct {
 }
 
 type ConsumerConfig struct {
-	ClientId           string        `mapstructure:"clientId"`
-	IsolationLevel     string        `mapstructure:"isolationLevel"`
-	ConsumerGroup      string        `mapstructure:"consumerGroup"`
-	SessionTimeout     time.Duration `mapstructure:"sessionTimeout"`
-	HeartbeatInterval  time.Duration `mapstructure:"heartbeatInterval"`
-	MaxPollRecords     int           `mapstructure:"maxPollRecords"`
-	AutoOffsetReset    string        `mapstructure:"autoOffsetReset"`
-	AutoCommitInterval time.Duration `mapstructure:"autoCommitInterval"`
-	AutoCommitEnabled  bool          `mapstructure:"autoCommitEnabled"`
-	MaxPollInterval    time.Duration `mapstructure:"maxPollInterval"`
-	LogBatchSize       int           `mapstructure:"logBatchSize"`
+	ClientId       string `mapstructure:"clientId"`
+	IsolationLevel string `mapstructure:"isolationLevel"`
+	ConsumerGroup  string `mapstructure:"consumerGroup"`
+	// GroupInstanceId enables static group membership when set
+	GroupInstanceId    string           `mapstructure:"groupInstanceId"`
+	SessionTimeout     time.Duration    `mapstructure:"sessionTimeout"`
+	HeartbeatInterval  time.Duration    `mapstructure:"heartbeatInterval"`
+	MaxPollRecords     int              `mapstructure:"maxPollRecords"`
+	AutoOffsetReset    string           `mapstructure:"autoOffsetReset"`
+	AutoCommitInterval time.Duration    `mapstructure:"autoCommitInterval"`
+	AutoCommitEnabled  bool             `mapstructure:"autoCommitEnabled"`
+	MaxPollInterval    time.Duration    `mapstructure:"maxPollInterval"`
+	LogBatchSize       int              `mapstructure:"logBatchSize"`
+	DeadLetter         DeadLetterConfig `mapstructure:"deadLetter"`
+	// PartitionAssignmentStrategy is e.g. "range,roundrobin" or "cooperative-sticky"
+	PartitionAssignmentStrategy string `mapstructure:"partitionAssignmentStrategy"`
+	// LagInterval is how often lag is computed for the assigned partitions; 0 disables it
+	LagInterval time.Duration     `mapstructure:"lagInterval"`
+	Concurrency ConcurrencyConfig `mapstructure:"concurrency"`
+	Batch       BatchConfig       `mapstructure:"batch"`
+	Commit      CommitConfig      `mapstructure:"commit"`
+	// Topics, when set, replaces KafkaConfig.Topic in the subscription. Entries starting
+	// with "^" are regular expressions, e.g. "^entity-.*"; with DeadLetter enabled they
+	// must not match the retry and DLQ topics derived from them
+	Topics []string `mapstructure:"topics"`
+	// Routes send the messages of matching topics to a named handler of the plugin
+	Routes []TopicRouteConfig `mapstructure:"routes"`
+	// TopicRefreshInterval is how often metadata is refreshed, which is how topics
+	// created after subscribing are matched by a pattern; 0 keeps the client default
+	TopicRefreshInterval time.Duration `mapstructure:"topicRefreshInterval"`
+	// StartFrom is applied the first time the job is assigned each partition
+	StartFrom StartPosition `mapstructure:"startFrom"`
+}
+
+// TopicRouteConfig routes the messages of a topic to a handler of the consumer plugin:
+// * Pattern - a topic, or a "^"-prefixed regular expression; the first matching route wins
+// * Handler - the name of the handler, e.g. "apply" or "skip" for entity-repo
+type TopicRouteConfig struct {
+	Pattern string `mapstructure:"pattern"`
+	Handler string `mapstructure:"handler"`
+}
+
+// BatchConfig switches a consumer to batch consumption, for plugins that support it:
+// * Enabled - when true, takes precedence over Concurrency
+// * Size - the maximum number of messages per batch; 0 means MaxPollRecords
+// * MaxWait - how long the first message of a partial batch may wait; 0 means 1s
+type BatchConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Size    int           `mapstructure:"size"`
+	MaxWait time.Duration `mapstructure:"maxWait"`
+}
+
+const (
+	OrderByPartition = "partition"
+	OrderByKey       = "key"
+)
+
+// ConcurrencyConfig determines how a consumer processes the messages it polls:
+// * Workers - the number of goroutines handling messages; 0 or 1 handles them on the poll loop
+// * OrderBy - "partition" (default) or "key": messages sharing one are handled in order
+// * MaxInFlight - the number of unfinished messages at which polling pauses; 0 means 100 per worker
+type ConcurrencyConfig struct {
+	Workers     int    `mapstructure:"workers"`
+	OrderBy     string `mapstructure:"orderBy"`
+	MaxInFlight int    `mapstructure:"maxInFlight"`
+}
+
+const (
+	CommitSync          = "sync"
+	CommitAsync         = "async"
+	CommitEveryMessages = "messages"
+	CommitInterval      = "interval"
+	CommitOnRevoke      = "revoke"
+)
+
+// CommitConfig determines when offsets are committed while auto-commit is off:
+// * Strategy - "sync" (default) commits each accepted message and waits, "async" commits
+// each accepted message in the background, in order and without waiting for the result,
+// "messages" commits every EveryMessages accepted messages, "interval" every Interval,
+// and "revoke" only when partitions are revoked or the job stops. With batches or
+// concurrent workers, "async" commits their stored offsets in the background instead.
+// * EveryMessages - the number of accepted messages per commit for the messages strategy
+// * Interval - the time between commits for the interval strategy
+type CommitConfig struct {
+	Strategy      string        `mapstructure:"strategy"`
+	EveryMessages int           `mapstructure:"everyMessages"`
+	Interval      time.Duration `mapstructure:"interval"`
+}
+
+// IsSync reports whether each accepted message is committed synchronously.
+func (c CommitConfig) IsSync() bool {
+	return c.Strategy == "" || c.Strategy == CommitSync
+}
+
+func (c CommitConfig) Validate() error {
+	switch c.Strategy {
+	case "", CommitSync, CommitAsync, CommitOnRevoke:
+		return nil
+	case CommitEveryMessages:
+		if c.EveryMessages <= 0 {
+			return errors.New("messages commit strategy requires everyMessages > 0")
+		}
+		return nil
+	case CommitInterval:
+		if c.Interval <= 0 {
+			return errors.New("interval commit strategy requires interval > 0")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown commit strategy %q", c.Strategy)
+	}
 }
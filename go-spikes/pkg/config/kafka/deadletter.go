@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const DeadLetterTopicSuffix = ".dlq"
+
+// DeadLetterConfig determines where a consumer sends messages its plugin rejects:
+// * Enabled - when false, rejected messages are logged and skipped
+// * RetryDelays - one retry topic per delay; a rejected message moves to the next
+// tier and is retried once its delay has passed. After the last tier it goes to the DLQ.
+type DeadLetterConfig struct {
+	Enabled     bool            `mapstructure:"enabled"`
+	RetryDelays []time.Duration `mapstructure:"retryDelays"`
+}
+
+// DeadLetterTopic returns the DLQ topic for the given source topic.
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterTopicSuffix
+}
+
+// RetryTopic returns the retry topic for the given source topic and 1-based tier.
+func RetryTopic(topic string, tier int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, tier)
+}
+
+// DeadLetterTopic returns the DLQ topic for kc.Topic.
+func (kc KafkaConfig) DeadLetterTopic() string {
+	return DeadLetterTopic(kc.Topic)
+}
+
+// RetryTopic returns the retry topic of the given 1-based tier for kc.Topic.
+func (kc KafkaConfig) RetryTopic(tier int) string {
+	return RetryTopic(kc.Topic, tier)
+}
+
+// DeadLetterTopics returns the DLQ topics, or patterns, of every subscribed topic and
+// pattern. Rejected messages go to the DLQ of the topic they were consumed from.
+func (kc KafkaConfig) DeadLetterTopics() []string {
+	return derivedTopics(kc.SubscriptionTopics(), DeadLetterTopicSuffix)
+}
+
+// RetryTopics returns the retry topics, or patterns, of the given 1-based tier for every
+// subscribed topic and pattern.
+func (kc KafkaConfig) RetryTopics(tier int) []string {
+	return derivedTopics(kc.SubscriptionTopics(), RetryTopic("", tier))
+}
+
+// derivedTopics appends suffix to topics; a pattern is anchored so that it only matches
+// the derived topics of the topics it matches.
+func derivedTopics(topics []string, suffix string) []string {
+	derived := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if !IsTopicPattern(topic) {
+			derived = append(derived, topic+suffix)
+			continue
+		}
+		pattern := strings.TrimSuffix(strings.TrimPrefix(topic, "^"), "$")
+		derived = append(derived, "^("+pattern+")"+strings.ReplaceAll(suffix, ".", `\.`)+"$")
+	}
+	return derived
+}
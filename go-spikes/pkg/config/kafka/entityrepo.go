@@ -3,13 +3,23 @@ package kafka
 import "time"
 
 type EntityRepoConfig struct {
-	PluginsConfig  PluginsConfig `mapstructure:"plugins"`
-	KafkaOverrides KafkaConfig   `mapstructure:"kafkaOverrides"`
+	PluginsConfig  PluginsConfig    `mapstructure:"plugins"`
+	KafkaOverrides KafkaConfig      `mapstructure:"kafkaOverrides"`
+	TopicSpec      TopicSpec        `mapstructure:"topicSpec"`
+	GroupScale     GroupScaleConfig `mapstructure:"groupScale"`
+}
+
+// Redacted returns a copy of the EntityRepoConfig with the override credentials masked.
+func (ec EntityRepoConfig) Redacted() EntityRepoConfig {
+	ec.KafkaOverrides = ec.KafkaOverrides.Redacted()
+	return ec
 }
 
 type PluginsConfig struct {
-	ConsumerPluginConfig ConsumerPluginConfig `mapstructure:"consumer"`
-	ProducerPluginConfig ProducerPluginConfig `mapstructure:"producer"`
+	ConsumerPluginConfig         ConsumerPluginConfig `mapstructure:"consumer"`
+	ProducerPluginConfig         ProducerPluginConfig `mapstructure:"producer"`
+	DeadLetterReplayPluginConfig ConsumerPluginConfig `mapstructure:"dlqReplay"`
+	GroupScalePluginConfig       ConsumerPluginConfig `mapstructure:"groupScale"`
 }
 
 // ProducerPluginConfig determines how the nature of ProducerEngine's Plugin behaves with:
@@ -17,23 +27,113 @@ type PluginsConfig struct {
 // * AttributeCount - the number of random attributes to generate for each Payload
 // * RunDuration - the total duration to run the ProducerEngine
 // * IntervalDuration - the interval between producing payloads
+// * DeleteRatio - the fraction (0-1) of events that delete an entity with a tombstone
+// * Generator - how entities are picked and their attributes generated
 type ProducerPluginConfig struct {
-	JobName              string        `mapstructure:"jobName"`
-	EntityCount          int           `mapstructure:"entityCount"`
-	AttributeCount       int           `mapstructure:"attributeCount"`
-	InitialDelayDuration time.Duration `mapstructure:"initialDelayDuration"`
-	RunDuration          time.Duration `mapstructure:"runDuration"`
-	IntervalDuration     time.Duration `mapstructure:"intervalDuration"`
-	LogBatchSize         int           `mapstructure:"logBatchSize"`
+	JobName              string          `mapstructure:"jobName"`
+	EntityCount          int             `mapstructure:"entityCount"`
+	AttributeCount       int             `mapstructure:"attributeCount"`
+	DeleteRatio          float64         `mapstructure:"deleteRatio"`
+	InitialDelayDuration time.Duration   `mapstructure:"initialDelayDuration"`
+	RunDuration          time.Duration   `mapstructure:"runDuration"`
+	IntervalDuration     time.Duration   `mapstructure:"intervalDuration"`
+	LogBatchSize         int             `mapstructure:"logBatchSize"`
+	Generator            GeneratorConfig `mapstructure:"generator"`
+}
+
+const (
+	KeysSequential = "sequential"
+	KeysUniform    = "uniform"
+	KeysZipfian    = "zipfian"
+
+	AttributeString    = "string"
+	AttributeInt       = "int"
+	AttributeFloat     = "float"
+	AttributeBool      = "bool"
+	AttributeTimestamp = "timestamp"
+	AttributeObject    = "object"
+	AttributeArray     = "array"
+)
+
+// GeneratorConfig makes the producer's payloads reproducible and realistic:
+// * Seed - seeds every random choice; 0 picks a seed, which is logged so a run can be repeated
+// * KeyDistribution - sequential (default, round-robin), uniform or zipfian
+// * ZipfS and ZipfV - the zipfian skew (s > 1, default 1.1) and offset (v >= 1, default 1)
+// * NewEntityRate - the fraction (0-1) of events that create an entity beyond EntityCount
+// * MinAttributeCount - when below AttributeCount, each entity has between the two attributes
+// * AttributeTypes - the types attributes cycle through; string when empty
+// * V2Ratio - the fraction (0-1) of payloads emitted in the v2 schema rather than v1
+type GeneratorConfig struct {
+	Seed              int64    `mapstructure:"seed"`
+	KeyDistribution   string   `mapstructure:"keyDistribution"`
+	ZipfS             float64  `mapstructure:"zipfS"`
+	ZipfV             float64  `mapstructure:"zipfV"`
+	NewEntityRate     float64  `mapstructure:"newEntityRate"`
+	MinAttributeCount int      `mapstructure:"minAttributeCount"`
+	AttributeTypes    []string `mapstructure:"attributeTypes"`
+	V2Ratio           float64  `mapstructure:"v2Ratio"`
 }
 
 // ConsumerPluginConfig determines how the nature of Payload Generator's behavior with:
 // * RunDuration - the total duration to run the ProducerEngine
 // * IntervalDuration - the interval between producing payloads
+// * ProcessingCost - simulated work per consumed message
+// * StateStore - where the materialized view is kept
+// * SchemaVersion - the newest payload version the consumer reads; older ones are upcast
+// * Sink - a database the consumed entities are upserted into
 type ConsumerPluginConfig struct {
-	JobName              string        `mapstructure:"jobName"`
-	InitialDelayDuration time.Duration `mapstructure:"initialDelayDuration"`
-	RunDuration          time.Duration `mapstructure:"runDuration"`
-	IntervalDuration     time.Duration `mapstructure:"intervalDuration"`
-	LogBatchSize         int           `mapstructure:"logBatchSize"`
+	JobName              string               `mapstructure:"jobName"`
+	InitialDelayDuration time.Duration        `mapstructure:"initialDelayDuration"`
+	RunDuration          time.Duration        `mapstructure:"runDuration"`
+	IntervalDuration     time.Duration        `mapstructure:"intervalDuration"`
+	LogBatchSize         int                  `mapstructure:"logBatchSize"`
+	ProcessingCost       ProcessingCostConfig `mapstructure:"processingCost"`
+	StateStore           StateStoreConfig     `mapstructure:"stateStore"`
+	SchemaVersion        int                  `mapstructure:"schemaVersion"`
+	Sink                 SQLSinkConfig        `mapstructure:"sink"`
+}
+
+const (
+	StateStoreMemory = "memory"
+	StateStoreDisk   = "disk"
+)
+
+// StateStoreConfig selects the store of a consumer's materialized view:
+// * Type - "memory" (default) or "disk"
+// * MaxEntries - memory only: least recently used entries beyond it are evicted; 0 is unbounded
+// * TTL - memory only: entries not updated for this long expire; 0 never expires
+// * Path - disk only: the database file, restored on start
+// * SnapshotInterval - disk only: how often state and offsets are written; 0 means 10s
+type StateStoreConfig struct {
+	Type             string        `mapstructure:"type"`
+	MaxEntries       int           `mapstructure:"maxEntries"`
+	TTL              time.Duration `mapstructure:"ttl"`
+	Path             string        `mapstructure:"path"`
+	SnapshotInterval time.Duration `mapstructure:"snapshotInterval"`
+}
+
+const (
+	CostFixed     = "fixed"
+	CostUniform   = "uniform"
+	CostLognormal = "lognormal"
+	CostFibonacci = "fibonacci"
+)
+
+// ProcessingCostConfig simulates the work a real consumer does per message:
+// * Model - "" for none, "fixed", "uniform" or "lognormal" sleeps, or "fibonacci" CPU burn
+// * Duration - the fixed sleep, or the median of the lognormal sleep
+// * MinDuration, MaxDuration - the bounds of the uniform sleep
+// * Sigma - the spread of the lognormal sleep; 0 means 0.5
+// * FibonacciN - the Fibonacci number computed per message by the fibonacci model
+// * StallProbability - the chance (0-1) that a message stalls for StallDuration on top,
+// e.g. longer than maxPollInterval to get the member evicted from its group
+type ProcessingCostConfig struct {
+	Model            string        `mapstructure:"model"`
+	Duration         time.Duration `mapstructure:"duration"`
+	MinDuration      time.Duration `mapstructure:"minDuration"`
+	MaxDuration      time.Duration `mapstructure:"maxDuration"`
+	Sigma            float64       `mapstructure:"sigma"`
+	FibonacciN       int           `mapstructure:"fibonacciN"`
+	StallProbability float64       `mapstructure:"stallProbability"`
+	StallDuration    time.Duration `mapstructure:"stallDuration"`
 }
@@ -0,0 +1,21 @@
+package kafka
+
+import "time"
+
+// GroupScaleConfig drives an in-process consumer group experiment:
+// * Members - the number of consumers the job starts with
+// * StaticMembership - gives each member a group.instance.id, so a member that leaves and
+// rejoins within the session timeout gets its partitions back without a rebalance
+// * Steps - changes to the number of members, each After the start of the job
+// * StabilizeTimeout - how long to wait for the group to settle after a change; 0 means 2m
+type GroupScaleConfig struct {
+	Members          int              `mapstructure:"members"`
+	StaticMembership bool             `mapstructure:"staticMembership"`
+	Steps            []GroupScaleStep `mapstructure:"steps"`
+	StabilizeTimeout time.Duration    `mapstructure:"stabilizeTimeout"`
+}
+
+type GroupScaleStep struct {
+	After   time.Duration `mapstructure:"after"`
+	Members int           `mapstructure:"members"`
+}
@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	StartFromCommitted = "committed"
+	StartFromEarliest  = "earliest"
+	StartFromLatest    = "latest"
+	StartFromTimestamp = "timestamp"
+	StartFromOffsets   = "offsets"
+)
+
+// StartPosition is where a consumer reads a partition from, either the first time the
+// partition is assigned to the job or when a running job is asked to seek:
+// * Position - committed (default), earliest, latest, timestamp or offsets
+// * Timestamp - RFC 3339 time to start from, for the timestamp position
+// * Offsets - explicit offsets per topic partition, for the offsets position; partitions
+// that are not listed keep their committed offset, and an offset without a topic is for
+// KafkaConfig.Topic
+type StartPosition struct {
+	Position  string            `mapstructure:"position" json:"position"`
+	Timestamp string            `mapstructure:"timestamp" json:"timestamp,omitempty"`
+	Offsets   []PartitionOffset `mapstructure:"offsets" json:"offsets,omitempty"`
+}
+
+type PartitionOffset struct {
+	Topic     string `mapstructure:"topic" json:"topic,omitempty"`
+	Partition int32  `mapstructure:"partition" json:"partition"`
+	Offset    int64  `mapstructure:"offset" json:"offset"`
+}
+
+// IsCommitted reports whether the position leaves partitions at their committed offsets.
+func (p StartPosition) IsCommitted() bool {
+	return p.Position == "" || p.Position == StartFromCommitted
+}
+
+// Time parses Timestamp.
+func (p StartPosition) Time() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, p.Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start timestamp %q: %w", p.Timestamp, err)
+	}
+	return t, nil
+}
+
+func (p StartPosition) Validate() error {
+	switch p.Position {
+	case "", StartFromCommitted, StartFromEarliest, StartFromLatest:
+		return nil
+	case StartFromTimestamp:
+		_, err := p.Time()
+		return err
+	case StartFromOffsets:
+		if len(p.Offsets) == 0 {
+			return errors.New("offsets start position requires at least one partition offset")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown start position %q", p.Position)
+	}
+}
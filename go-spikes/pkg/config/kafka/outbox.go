@@ -0,0 +1,51 @@
+package kafka
+
+import "time"
+
+// OutboxConfig configures the transactional outbox spike, which writes entities and
+// their outbox events to database.postgres in one transaction, and relays the events to
+// Kafka:
+// * EntityTable and OutboxTable - the tables written by the writer, created if missing
+// * Writer - the jobName, timings and payload generation of the writer
+// * Relay - how the relay picks up events, and how often it is killed
+// * Verifier - the consumer that checks every event of the run arrived exactly once
+type OutboxConfig struct {
+	KafkaOverrides KafkaConfig          `mapstructure:"kafkaOverrides"`
+	EntityTable    string               `mapstructure:"entityTable"`
+	OutboxTable    string               `mapstructure:"outboxTable"`
+	Writer         ProducerPluginConfig `mapstructure:"writer"`
+	Relay          OutboxRelayConfig    `mapstructure:"relay"`
+	Verifier       ConsumerPluginConfig `mapstructure:"verifier"`
+}
+
+// Redacted returns a copy of the OutboxConfig with the override credentials masked.
+func (oc OutboxConfig) Redacted() OutboxConfig {
+	oc.KafkaOverrides = oc.KafkaOverrides.Redacted()
+	return oc
+}
+
+const (
+	RelayPoll   = "poll"
+	RelayNotify = "notify"
+)
+
+// OutboxRelayConfig determines how the relay moves outbox events to Kafka:
+// * Mode - "poll" (default) polls every PollInterval; "notify" also wakes up on the
+// writer's NOTIFY, which needs a direct or session pooled connection
+// * PollInterval - the wait after a poll that found no events; 0 means 100ms
+// * BatchSize - the most events fetched per poll; 0 means 500
+// * MaxInFlight - the most events produced but not yet acknowledged; 0 means 5000
+// * KillAfter - kills the relay this long after it starts, and starts a new one, until
+// RunDuration; a killed relay neither flushes nor marks its in-flight events. 0 never kills it
+type OutboxRelayConfig struct {
+	JobName              string        `mapstructure:"jobName"`
+	InitialDelayDuration time.Duration `mapstructure:"initialDelayDuration"`
+	RunDuration          time.Duration `mapstructure:"runDuration"`
+	IntervalDuration     time.Duration `mapstructure:"intervalDuration"`
+	LogBatchSize         int           `mapstructure:"logBatchSize"`
+	Mode                 string        `mapstructure:"mode"`
+	PollInterval         time.Duration `mapstructure:"pollInterval"`
+	BatchSize            int           `mapstructure:"batchSize"`
+	MaxInFlight          int           `mapstructure:"maxInFlight"`
+	KillAfter            time.Duration `mapstructure:"killAfter"`
+}
@@ -0,0 +1,63 @@
+package kafka
+
+const redactedValue = "******"
+
+// SecurityConfig describes how clients authenticate against a secured listener:
+// * Protocol - security.protocol: PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL
+// * SaslMechanism - sasl.mechanisms: SCRAM-SHA-512, SCRAM-SHA-256 or PLAIN
+// * Username/UsernameFile - the SASL username, inline or read from a mounted secret file
+// * PasswordFile - the SASL password, read from a mounted secret file
+// * CALocation - the CA certificate used to verify the brokers
+// * CertificateLocation/KeyLocation - the client certificate and key for mTLS
+// * KeyPasswordFile - the password of the client key, read from a mounted secret file
+type SecurityConfig struct {
+	Protocol            string `mapstructure:"protocol"`
+	SaslMechanism       string `mapstructure:"saslMechanism"`
+	Username            string `mapstructure:"username"`
+	UsernameFile        string `mapstructure:"usernameFile"`
+	PasswordFile        string `mapstructure:"passwordFile"`
+	CALocation          string `mapstructure:"caLocation"`
+	CertificateLocation string `mapstructure:"certificateLocation"`
+	KeyLocation         string `mapstructure:"keyLocation"`
+	KeyPasswordFile     string `mapstructure:"keyPasswordFile"`
+}
+
+func ApplySecurityConfigOverrides(sc SecurityConfig, overrides SecurityConfig) SecurityConfig {
+	if overrides.Protocol != "" {
+		sc.Protocol = overrides.Protocol
+	}
+	if overrides.SaslMechanism != "" {
+		sc.SaslMechanism = overrides.SaslMechanism
+	}
+	if overrides.Username != "" {
+		sc.Username = overrides.Username
+	}
+	if overrides.UsernameFile != "" {
+		sc.UsernameFile = overrides.UsernameFile
+	}
+	if overrides.PasswordFile != "" {
+		sc.PasswordFile = overrides.PasswordFile
+	}
+	if overrides.CALocation != "" {
+		sc.CALocation = overrides.CALocation
+	}
+	if overrides.CertificateLocation != "" {
+		sc.CertificateLocation = overrides.CertificateLocation
+	}
+	if overrides.KeyLocation != "" {
+		sc.KeyLocation = overrides.KeyLocation
+	}
+	if overrides.KeyPasswordFile != "" {
+		sc.KeyPasswordFile = overrides.KeyPasswordFile
+	}
+	return sc
+}
+
+// Redacted returns a copy that is safe to expose, e.g. through GET /config.
+// Secret file paths are kept, as they only point at the mounted secrets.
+func (sc SecurityConfig) Redacted() SecurityConfig {
+	if sc.Username != "" {
+		sc.Username = redactedValue
+	}
+	return sc
+}
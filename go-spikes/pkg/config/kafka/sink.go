@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	SinkMySQL    = "mysql"
+	SinkPostgres = "postgres"
+)
+
+// SQLSinkConfig makes a consumer upsert what it consumes into a database, with the
+// connection of database.mysql or database.postgres:
+// * Database - mysql or postgres
+// * Table - the table of the records, created if missing
+// * BatchSize - records written per transaction; the consumer batches messages to match
+// * FlushInterval - how long a partial batch waits before it is written
+// * MaxRetries and RetryBackoff - attempts of a failed transaction, doubling the backoff;
+// a batch that still fails is consumed again rather than committed
+type SQLSinkConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Database      string        `mapstructure:"database"`
+	Table         string        `mapstructure:"table"`
+	BatchSize     int           `mapstructure:"batchSize"`
+	FlushInterval time.Duration `mapstructure:"flushInterval"`
+	MaxRetries    int           `mapstructure:"maxRetries"`
+	RetryBackoff  time.Duration `mapstructure:"retryBackoff"`
+}
+
+func (sc SQLSinkConfig) Validate() error {
+	switch sc.Database {
+	case SinkMySQL, SinkPostgres:
+	default:
+		return fmt.Errorf("unknown sink database %q", sc.Database)
+	}
+	if sc.Table == "" {
+		return fmt.Errorf("sink table is required")
+	}
+	if sc.BatchSize <= 0 {
+		return fmt.Errorf("sink batchSize must be greater than zero")
+	}
+	return nil
+}
+
+// BatchConfig returns the consumer batching that feeds the sink.
+func (sc SQLSinkConfig) BatchConfig() BatchConfig {
+	return BatchConfig{
+		Enabled: true,
+		Size:    sc.BatchSize,
+		MaxWait: sc.FlushInterval,
+	}
+}
@@ -0,0 +1,67 @@
+package kafka
+
+import "time"
+
+// TrafficConfig records a topic's messages to files, and replays such files, so that a
+// traffic sample can be reused across experiments.
+type TrafficConfig struct {
+	KafkaOverrides KafkaConfig   `mapstructure:"kafkaOverrides"`
+	Capture        CaptureConfig `mapstructure:"capture"`
+	Replay         ReplayConfig  `mapstructure:"replay"`
+}
+
+// Redacted returns a copy of the TrafficConfig with the override credentials masked.
+func (tc TrafficConfig) Redacted() TrafficConfig {
+	tc.KafkaOverrides = tc.KafkaOverrides.Redacted()
+	return tc
+}
+
+// CaptureConfig makes the capture job write every consumed message, with its key, value,
+// headers and timestamp, as a line of JSON:
+// * Dir - the directory of the files, created if missing
+// * FilePrefix - the start of the file names, followed by when the file was opened;
+// defaults to the topic
+// * Compress - gzip the files, named .jsonl.gz instead of .jsonl
+// * MaxFileBytes - rotates a file once it holds this many uncompressed bytes; 0 means 64MiB
+// * MaxFileAge - rotates a file open for longer, at its next message; 0 never rotates on age
+type CaptureConfig struct {
+	JobName              string        `mapstructure:"jobName"`
+	InitialDelayDuration time.Duration `mapstructure:"initialDelayDuration"`
+	RunDuration          time.Duration `mapstructure:"runDuration"`
+	IntervalDuration     time.Duration `mapstructure:"intervalDuration"`
+	LogBatchSize         int           `mapstructure:"logBatchSize"`
+	Dir                  string        `mapstructure:"dir"`
+	FilePrefix           string        `mapstructure:"filePrefix"`
+	Compress             bool          `mapstructure:"compress"`
+	MaxFileBytes         int64         `mapstructure:"maxFileBytes"`
+	MaxFileAge           time.Duration `mapstructure:"maxFileAge"`
+}
+
+const (
+	ReplayJSONL = "jsonl"
+	ReplayCSV   = "csv"
+
+	ReplayOriginal = "original"
+	ReplayScaled   = "scaled"
+	ReplayFast     = "fast"
+)
+
+// ReplayConfig makes the replay job produce recorded messages to kafka.topic:
+// * Path - a file, or a glob of files replayed in name order, e.g. rotated capture files
+// * Format - "jsonl" (default), as written by the capture job, or "csv" with a header
+// row naming its timestamp, key, value and headers columns; files ending in .gz are
+// decompressed
+// * Timing - "original" (default) keeps the gaps between the recorded timestamps,
+// "scaled" divides them by Speed, and "fast" produces without pause
+// * Speed - the speedup of scaled timing, e.g. 2 replays twice as fast
+type ReplayConfig struct {
+	JobName              string        `mapstructure:"jobName"`
+	InitialDelayDuration time.Duration `mapstructure:"initialDelayDuration"`
+	RunDuration          time.Duration `mapstructure:"runDuration"`
+	IntervalDuration     time.Duration `mapstructure:"intervalDuration"`
+	LogBatchSize         int           `mapstructure:"logBatchSize"`
+	Path                 string        `mapstructure:"path"`
+	Format               string        `mapstructure:"format"`
+	Timing               string        `mapstructure:"timing"`
+	Speed                float64       `mapstructure:"speed"`
+}
@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// LoadConfig drives a database load job against a generated table:
+// * Table - the table, created if missing
+// * Rows - the rows the table is seeded with before the run
+// * PayloadBytes - the size of the payload written to each row; 0 means 256
+// * Workers - concurrent workers, each using one connection at a time; 0 means 1
+// * Mix - the relative weights of the operations the workers pick from
+// * IntervalDuration - the pause of each worker between operations
+// * Target - postgres only: "direct" (default) to the cluster, or "pooler" through PgBouncer
+type LoadConfig struct {
+	JobName              string        `mapstructure:"jobName"`
+	InitialDelayDuration time.Duration `mapstructure:"initialDelayDuration"`
+	RunDuration          time.Duration `mapstructure:"runDuration"`
+	IntervalDuration     time.Duration `mapstructure:"intervalDuration"`
+	LogBatchSize         int           `mapstructure:"logBatchSize"`
+	Table                string        `mapstructure:"table"`
+	Rows                 int           `mapstructure:"rows"`
+	PayloadBytes         int           `mapstructure:"payloadBytes"`
+	Workers              int           `mapstructure:"workers"`
+	Mix                  LoadMix       `mapstructure:"mix"`
+	Target               string        `mapstructure:"target"`
+}
+
+// LoadMix weighs the operations of a load job; reads select a row by id, writes insert a
+// row, updates change one and deletes remove one. Ids are picked uniformly among the rows
+// the job knows of.
+type LoadMix struct {
+	Read   int `mapstructure:"read"`
+	Write  int `mapstructure:"write"`
+	Update int `mapstructure:"update"`
+	Delete int `mapstructure:"delete"`
+}
@@ -0,0 +1,396 @@
+package dbload
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/infra-bed/go-spikes/pkg/config"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/model"
+	"github.com/infra-bed/go-spikes/pkg/tracing"
+)
+
+// Operations of a load job, named as in the database metrics.
+const (
+	OpSelect = "select"
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+const (
+	defaultPayloadBytes = 256
+	// sampleInterval is how often the pool's connections are reported
+	sampleInterval = time.Second
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidTableName reports whether name can be used as a table name without quoting.
+func ValidTableName(name string) bool {
+	return tableName.MatchString(name)
+}
+
+// Table is the generated table of a load job, implemented per database. Rows are keyed
+// by an increasing id and carry a category, a payload and a counter.
+type Table interface {
+	// Prepare creates the table if it is missing, seeds it up to rows rows, and returns
+	// the highest id.
+	Prepare(ctx context.Context, rows int, payload func() string) (int64, error)
+	// Read, Update and Delete report whether the row with id was found.
+	Read(ctx context.Context, id int64) (bool, error)
+	Insert(ctx context.Context, category int64, payload string) (int64, error)
+	Update(ctx context.Context, id int64, payload string) (bool, error)
+	Delete(ctx context.Context, id int64) (bool, error)
+	PoolStats() PoolStats
+	Close()
+}
+
+// PoolStats is a snapshot of a table's connection pool:
+// * MaxOpen - the most connections the pool opens
+// * Open, InUse and Idle - the connections open, and how they are split
+// * WaitCount and WaitDuration - acquisitions that had to wait for a connection
+type PoolStats struct {
+	MaxOpen      int           `json:"maxOpen"`
+	Open         int           `json:"open"`
+	InUse        int           `json:"inUse"`
+	Idle         int           `json:"idle"`
+	WaitCount    int64         `json:"waitCount"`
+	WaitDuration time.Duration `json:"waitDuration"`
+}
+
+// OperationStats summarises one operation of the mix:
+// * Misses - reads, updates and deletes of an id no longer in the table
+// * MeanMillis and MaxMillis - the latency of the operations, errors included
+type OperationStats struct {
+	Operation  string  `json:"operation"`
+	Count      int64   `json:"count"`
+	Errors     int64   `json:"errors"`
+	Misses     int64   `json:"misses"`
+	MeanMillis float64 `json:"meanMillis"`
+	MaxMillis  float64 `json:"maxMillis"`
+}
+
+// LoadStats is the result of a load job.
+type LoadStats struct {
+	Database         string           `json:"database"`
+	Target           string           `json:"target,omitempty"`
+	Table            string           `json:"table"`
+	Workers          int              `json:"workers"`
+	Operations       []OperationStats `json:"operations"`
+	OperationsPerSec float64          `json:"operationsPerSecond"`
+	Pool             PoolStats        `json:"pool"`
+}
+
+// Job runs the configured mix of operations against a Table from concurrent workers.
+type Job struct {
+	database     string
+	target       string
+	table        Table
+	loadCfg      config.LoadConfig
+	weights      []weightedOp
+	totalWeight  int
+	logBatchSize int
+	// maxID is the highest id known to exist, from the seeding and later inserts
+	maxID     atomic.Int64
+	completed atomic.Int64
+	// mu guards the stats below
+	mu      sync.Mutex
+	stats   map[string]*opStats
+	started time.Time
+	ended   time.Time
+}
+
+type weightedOp struct {
+	operation string
+	weight    int
+}
+
+type opStats struct {
+	count, errors, misses int64
+	total, max            time.Duration
+}
+
+// NewJob checks the mix of loadCfg. The target names the endpoint the table connects to,
+// e.g. a direct or pooled service, and is only reported.
+func NewJob(database, target string, table Table, loadCfg config.LoadConfig) (*Job, error) {
+	if !ValidTableName(loadCfg.Table) {
+		return nil, fmt.Errorf("invalid load table name %q", loadCfg.Table)
+	}
+	weights := []weightedOp{
+		{OpSelect, loadCfg.Mix.Read},
+		{OpInsert, loadCfg.Mix.Write},
+		{OpUpdate, loadCfg.Mix.Update},
+		{OpDelete, loadCfg.Mix.Delete},
+	}
+	var totalWeight int
+	for _, w := range weights {
+		if w.weight < 0 {
+			return nil, fmt.Errorf("load mix weight of %s must not be negative", w.operation)
+		}
+		totalWeight += w.weight
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("load mix needs at least one operation")
+	}
+	if loadCfg.Workers <= 0 {
+		loadCfg.Workers = 1
+	}
+	if loadCfg.PayloadBytes <= 0 {
+		loadCfg.PayloadBytes = defaultPayloadBytes
+	}
+	logBatchSize := loadCfg.LogBatchSize
+	if logBatchSize <= 0 {
+		logBatchSize = config.DefaultLogBatchSize
+	}
+	stats := make(map[string]*opStats, len(weights))
+	for _, w := range weights {
+		stats[w.operation] = &opStats{}
+	}
+	return &Job{
+		database:     database,
+		target:       target,
+		table:        table,
+		loadCfg:      loadCfg,
+		weights:      weights,
+		totalWeight:  totalWeight,
+		logBatchSize: logBatchSize,
+		stats:        stats,
+	}, nil
+}
+
+func (j *Job) GetPlugin() model.Plugin {
+	return j
+}
+
+func (j *Job) GetName() string {
+	return j.loadCfg.JobName
+}
+
+func (j *Job) GetInitialDelayDuration() time.Duration {
+	return j.loadCfg.InitialDelayDuration
+}
+
+func (j *Job) GetRunDuration() time.Duration {
+	return j.loadCfg.RunDuration
+}
+
+func (j *Job) GetIntervalDuration() time.Duration {
+	return j.loadCfg.IntervalDuration
+}
+
+// Close closes the table's pool once the job has finished.
+func (j *Job) Close() {
+	j.table.Close()
+}
+
+func (j *Job) Run(ctx context.Context) {
+	log := logger.Ctx(ctx)
+	seed := rand.New(rand.NewSource(time.Now().UnixNano()))
+	start := time.Now()
+	maxID, err := j.table.Prepare(ctx, j.loadCfg.Rows, func() string { return j.payload(seed) })
+	j.observe("prepare", start, err)
+	if err != nil {
+		log.Error().Err(err).Str("table", j.loadCfg.Table).Msg("Failed to prepare load table")
+		return
+	}
+	j.maxID.Store(maxID)
+	log.Info().
+		Str("database", j.database).
+		Str("target", j.target).
+		Int64("maxId", maxID).
+		Int("workers", j.loadCfg.Workers).
+		Msg("Starting database load")
+
+	j.mu.Lock()
+	j.started = time.Now()
+	j.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < j.loadCfg.Workers; worker++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			j.work(ctx, rng)
+		}(rand.New(rand.NewSource(seed.Int63())))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			j.mu.Lock()
+			j.ended = time.Now()
+			j.mu.Unlock()
+			metrics.DatabaseConnections.WithLabelValues(j.database).Set(float64(j.table.PoolStats().Open))
+			log.Info().Any("stats", j.Stats()).Msg("Finished database load")
+			return
+		case <-ticker.C:
+			metrics.DatabaseConnections.WithLabelValues(j.database).Set(float64(j.table.PoolStats().Open))
+		}
+	}
+}
+
+func (j *Job) work(ctx context.Context, rng *rand.Rand) {
+	intervalTimer := model.NewIntervalTimer(ctx, j)
+	for ctx.Err() == nil {
+		j.runOperation(ctx, rng, j.pick(rng))
+		if completed := j.completed.Add(1); completed%int64(j.logBatchSize) == 0 {
+			logger.Ctx(ctx).Info().Int64("operations", completed).Msg("database load operations")
+		}
+		intervalTimer.NextTickWait()
+	}
+}
+
+func (j *Job) pick(rng *rand.Rand) string {
+	n := rng.Intn(j.totalWeight)
+	for _, w := range j.weights {
+		if n < w.weight {
+			return w.operation
+		}
+		n -= w.weight
+	}
+	return OpSelect
+}
+
+// runOperation runs one operation on a random row; an empty table turns every
+// operation into an insert.
+func (j *Job) runOperation(ctx context.Context, rng *rand.Rand, operation string) {
+	maxID := j.maxID.Load()
+	if maxID == 0 {
+		operation = OpInsert
+	}
+	ctx, span := tracing.StartSpanWithAttributes(
+		ctx,
+		"db.load."+operation,
+		tracing.DatabaseAttributes(j.database, j.loadCfg.Table, operation),
+	)
+	defer span.End()
+
+	var id int64
+	if maxID > 0 {
+		id = rng.Int63n(maxID) + 1
+	}
+	found := true
+	var err error
+	start := time.Now()
+	switch operation {
+	case OpSelect:
+		found, err = j.table.Read(ctx, id)
+	case OpInsert:
+		var inserted int64
+		if inserted, err = j.table.Insert(ctx, rng.Int63n(100), j.payload(rng)); err == nil {
+			j.raiseMaxID(inserted)
+		}
+	case OpUpdate:
+		found, err = j.table.Update(ctx, id, j.payload(rng))
+	case OpDelete:
+		found, err = j.table.Delete(ctx, id)
+	}
+	elapsed := time.Since(start)
+	if ctx.Err() != nil && err != nil {
+		// the run ended during the operation
+		return
+	}
+	j.observe(operation, start, err)
+	if err != nil {
+		tracing.RecordError(span, err, "Failed to run "+operation)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stats := j.stats[operation]
+	stats.count++
+	stats.total += elapsed
+	stats.max = max(stats.max, elapsed)
+	switch {
+	case err != nil:
+		stats.errors++
+	case !found:
+		stats.misses++
+	}
+}
+
+func (j *Job) raiseMaxID(id int64) {
+	for {
+		current := j.maxID.Load()
+		if id <= current || j.maxID.CompareAndSwap(current, id) {
+			return
+		}
+	}
+}
+
+func (j *Job) observe(operation string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DatabaseOperations.WithLabelValues(j.database, operation, status).Inc()
+	metrics.DatabaseOperationDuration.WithLabelValues(j.database, operation).Observe(time.Since(start).Seconds())
+}
+
+const payloadAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func (j *Job) payload(rng *rand.Rand) string {
+	var payload strings.Builder
+	payload.Grow(j.loadCfg.PayloadBytes)
+	for i := 0; i < j.loadCfg.PayloadBytes; i++ {
+		payload.WriteByte(payloadAlphabet[rng.Intn(len(payloadAlphabet))])
+	}
+	return payload.String()
+}
+
+func (j *Job) GetResult() interface{} {
+	return j.Stats()
+}
+
+func (j *Job) Stats() LoadStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := LoadStats{
+		Database: j.database,
+		Target:   j.target,
+		Table:    j.loadCfg.Table,
+		Workers:  j.loadCfg.Workers,
+		Pool:     j.table.PoolStats(),
+	}
+	var total int64
+	for _, w := range j.weights {
+		stats := j.stats[w.operation]
+		operation := OperationStats{
+			Operation: w.operation,
+			Count:     stats.count,
+			Errors:    stats.errors,
+			Misses:    stats.misses,
+			MaxMillis: float64(stats.max) / float64(time.Millisecond),
+		}
+		if stats.count > 0 {
+			operation.MeanMillis = float64(stats.total) / float64(stats.count) / float64(time.Millisecond)
+		}
+		result.Operations = append(result.Operations, operation)
+		total += stats.count
+	}
+	if !j.started.IsZero() {
+		ended := j.ended
+		if ended.IsZero() {
+			ended = time.Now()
+		}
+		if elapsed := ended.Sub(j.started).Seconds(); elapsed > 0 {
+			result.OperationsPerSec = float64(total) / elapsed
+		}
+	}
+	return result
+}
@@ -0,0 +1,305 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+)
+
+const adminOperationTimeout = 30 * time.Second
+
+type TopicAdmin interface {
+	EnsureTopic(ctx context.Context, topic string, spec cfg.TopicSpec) error
+	FinishTopic(ctx context.Context, topic string, spec cfg.TopicSpec) error
+	DeleteTopic(ctx context.Context, topic string) error
+	TruncateTopic(ctx context.Context, topic string) error
+	DescribeTopics(ctx context.Context, topics []string) ([]TopicDescription, error)
+	Close()
+}
+
+// TopicDescription is a JSON-friendly view of a topic's partitions and configs.
+type TopicDescription struct {
+	Name              string               `json:"name"`
+	Partitions        int                  `json:"partitions"`
+	ReplicationFactor int                  `json:"replicationFactor"`
+	PartitionInfo     []TopicPartitionInfo `json:"partitionInfo"`
+	Configs           map[string]string    `json:"configs"`
+	Error             string               `json:"error,omitempty"`
+}
+
+type TopicPartitionInfo struct {
+	Partition int   `json:"partition"`
+	Leader    int   `json:"leader"`
+	Replicas  []int `json:"replicas"`
+	Isr       []int `json:"isr"`
+	Low       int64 `json:"lowWatermark"`
+	High      int64 `json:"highWatermark"`
+}
+
+func NewTopicAdmin(cfg cfg.KafkaConfig) (TopicAdmin, error) {
+	configMap, err := newClientConfigMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+	adminClient, err := k.NewAdminClient(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin client: %w", err)
+	}
+	return &topicAdminImpl{
+		adminClient: adminClient,
+	}, nil
+}
+
+type topicAdminImpl struct {
+	adminClient *k.AdminClient
+}
+
+func (a *topicAdminImpl) Close() {
+	a.adminClient.Close()
+}
+
+// EnsureTopic creates the topic from the spec when it does not exist yet.
+// When it already exists, the partition count, replication factor and configs
+// are validated against the spec and every mismatch is reported in the error.
+func (a *topicAdminImpl) EnsureTopic(ctx context.Context, topic string, spec cfg.TopicSpec) error {
+	log := logger.Ctx(ctx)
+	if !spec.Enabled {
+		return nil
+	}
+
+	descriptions, err := a.DescribeTopics(ctx, []string{topic})
+	if err != nil {
+		return err
+	}
+	if len(descriptions) == 1 && descriptions[0].Error == "" {
+		if mismatches := validateTopic(descriptions[0], spec); len(mismatches) > 0 {
+			return fmt.Errorf("topic %s does not match spec: %s", topic, strings.Join(mismatches, "; "))
+		}
+		log.Info().Str("topic", topic).Msg("Topic matches spec")
+		return nil
+	}
+
+	results, err := a.adminClient.CreateTopics(ctx, []k.TopicSpecification{{
+		Topic:             topic,
+		NumPartitions:     spec.Partitions,
+		ReplicationFactor: spec.ReplicationFactor,
+		Config:            spec.ConfigMap(),
+	}}, k.SetAdminOperationTimeout(adminOperationTimeout))
+	if err != nil {
+		return fmt.Errorf("failed to create topic %s: %w", topic, err)
+	}
+	for _, result := range results {
+		if result.Error.Code() != k.ErrNoError && result.Error.Code() != k.ErrTopicAlreadyExists {
+			return fmt.Errorf("failed to create topic %s: %w", result.Topic, result.Error)
+		}
+	}
+	log.Info().
+		Str("topic", topic).
+		Int("partitions", spec.Partitions).
+		Int("replicationFactor", spec.ReplicationFactor).
+		Any("configs", spec.ConfigMap()).
+		Msg("Topic created")
+	return nil
+}
+
+// FinishTopic applies the spec's OnFinish policy once the jobs using the topic are done.
+func (a *topicAdminImpl) FinishTopic(ctx context.Context, topic string, spec cfg.TopicSpec) error {
+	if !spec.Enabled {
+		return nil
+	}
+	switch spec.OnFinish {
+	case cfg.TopicOnFinishKeep:
+		return nil
+	case cfg.TopicOnFinishDelete:
+		return a.DeleteTopic(ctx, topic)
+	case cfg.TopicOnFinishTruncate:
+		return a.TruncateTopic(ctx, topic)
+	default:
+		return fmt.Errorf("unknown topic onFinish policy: %s", spec.OnFinish)
+	}
+}
+
+func (a *topicAdminImpl) DeleteTopic(ctx context.Context, topic string) error {
+	results, err := a.adminClient.DeleteTopics(ctx, []string{topic}, k.SetAdminOperationTimeout(adminOperationTimeout))
+	if err != nil {
+		return fmt.Errorf("failed to delete topic %s: %w", topic, err)
+	}
+	for _, result := range results {
+		if result.Error.Code() != k.ErrNoError {
+			return fmt.Errorf("failed to delete topic %s: %w", result.Topic, result.Error)
+		}
+	}
+	logger.Ctx(ctx).Info().Str("topic", topic).Msg("Topic deleted")
+	return nil
+}
+
+// TruncateTopic deletes all records up to the high watermark of every partition,
+// leaving the topic and its configs in place.
+func (a *topicAdminImpl) TruncateTopic(ctx context.Context, topic string) error {
+	descriptions, err := a.DescribeTopics(ctx, []string{topic})
+	if err != nil {
+		return err
+	}
+	if len(descriptions) != 1 || descriptions[0].Error != "" {
+		return fmt.Errorf("failed to describe topic %s before truncating", topic)
+	}
+
+	var partitions []k.TopicPartition
+	for _, partition := range descriptions[0].PartitionInfo {
+		partitions = append(partitions, k.TopicPartition{
+			Topic:     &topic,
+			Partition: int32(partition.Partition),
+			Offset:    k.OffsetEnd,
+		})
+	}
+
+	results, err := a.adminClient.DeleteRecords(ctx, partitions, k.SetAdminOperationTimeout(adminOperationTimeout))
+	if err != nil {
+		return fmt.Errorf("failed to truncate topic %s: %w", topic, err)
+	}
+	for _, result := range results.DeleteRecordsResults {
+		if result.TopicPartition.Error != nil {
+			return fmt.Errorf("failed to truncate topic %s partition %d: %w",
+				topic, result.TopicPartition.Partition, result.TopicPartition.Error)
+		}
+	}
+	logger.Ctx(ctx).Info().Str("topic", topic).Int("partitions", len(partitions)).Msg("Topic truncated")
+	return nil
+}
+
+// DescribeTopics describes the given topics, or every non-internal topic in the
+// cluster when none are given.
+func (a *topicAdminImpl) DescribeTopics(ctx context.Context, topics []string) ([]TopicDescription, error) {
+	if len(topics) == 0 {
+		metadata, err := a.adminClient.GetMetadata(nil, true, int(adminOperationTimeout.Milliseconds()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list topics: %w", err)
+		}
+		for name := range metadata.Topics {
+			if !strings.HasPrefix(name, "__") {
+				topics = append(topics, name)
+			}
+		}
+		sort.Strings(topics)
+	}
+
+	result, err := a.adminClient.DescribeTopics(ctx, k.NewTopicCollectionOfTopicNames(topics))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topics: %w", err)
+	}
+
+	var resources []k.ConfigResource
+	for _, topic := range topics {
+		resources = append(resources, k.ConfigResource{Type: k.ResourceTopic, Name: topic})
+	}
+	configs := make(map[string]map[string]string)
+	if configResults, err := a.adminClient.DescribeConfigs(ctx, resources); err != nil {
+		logger.Ctx(ctx).Warn().Err(err).Msg("Failed to describe topic configs")
+	} else {
+		for _, configResult := range configResults {
+			if configResult.Error.Code() != k.ErrNoError {
+				continue
+			}
+			configs[configResult.Name] = make(map[string]string)
+			for name, entry := range configResult.Config {
+				if !entry.IsSensitive {
+					configs[configResult.Name][name] = entry.Value
+				}
+			}
+		}
+	}
+
+	var descriptions []TopicDescription
+	for _, topicDescription := range result.TopicDescriptions {
+		description := TopicDescription{
+			Name:       topicDescription.Name,
+			Partitions: len(topicDescription.Partitions),
+			Configs:    configs[topicDescription.Name],
+		}
+		if topicDescription.Error.Code() != k.ErrNoError {
+			description.Error = topicDescription.Error.String()
+			descriptions = append(descriptions, description)
+			continue
+		}
+		for _, partition := range topicDescription.Partitions {
+			info := TopicPartitionInfo{
+				Partition: partition.Partition,
+				Leader:    -1,
+			}
+			if partition.Leader != nil {
+				info.Leader = partition.Leader.ID
+			}
+			for _, replica := range partition.Replicas {
+				info.Replicas = append(info.Replicas, replica.ID)
+			}
+			for _, isr := range partition.Isr {
+				info.Isr = append(info.Isr, isr.ID)
+			}
+			if len(partition.Replicas) > description.ReplicationFactor {
+				description.ReplicationFactor = len(partition.Replicas)
+			}
+			description.PartitionInfo = append(description.PartitionInfo, info)
+		}
+		a.addWatermarks(ctx, &description)
+		descriptions = append(descriptions, description)
+	}
+	return descriptions, nil
+}
+
+func (a *topicAdminImpl) addWatermarks(ctx context.Context, description *TopicDescription) {
+	earliest := make(map[k.TopicPartition]k.OffsetSpec)
+	latest := make(map[k.TopicPartition]k.OffsetSpec)
+	for _, partition := range description.PartitionInfo {
+		tp := k.TopicPartition{Topic: &description.Name, Partition: int32(partition.Partition)}
+		earliest[tp] = k.EarliestOffsetSpec
+		latest[tp] = k.LatestOffsetSpec
+	}
+	lows, err := a.adminClient.ListOffsets(ctx, earliest)
+	if err != nil {
+		logger.Ctx(ctx).Warn().Err(err).Str("topic", description.Name).Msg("Failed to list earliest offsets")
+		return
+	}
+	highs, err := a.adminClient.ListOffsets(ctx, latest)
+	if err != nil {
+		logger.Ctx(ctx).Warn().Err(err).Str("topic", description.Name).Msg("Failed to list latest offsets")
+		return
+	}
+	for i := range description.PartitionInfo {
+		partition := int32(description.PartitionInfo[i].Partition)
+		for tp, info := range lows.ResultInfos {
+			if tp.Partition == partition {
+				description.PartitionInfo[i].Low = int64(info.Offset)
+			}
+		}
+		for tp, info := range highs.ResultInfos {
+			if tp.Partition == partition {
+				description.PartitionInfo[i].High = int64(info.Offset)
+			}
+		}
+	}
+}
+
+func validateTopic(description TopicDescription, spec cfg.TopicSpec) []string {
+	var mismatches []string
+	if spec.Partitions > 0 && description.Partitions != spec.Partitions {
+		mismatches = append(mismatches,
+			fmt.Sprintf("partitions=%d, expected %d", description.Partitions, spec.Partitions))
+	}
+	if spec.ReplicationFactor > 0 && description.ReplicationFactor != spec.ReplicationFactor {
+		mismatches = append(mismatches,
+			fmt.Sprintf("replicationFactor=%d, expected %d", description.ReplicationFactor, spec.ReplicationFactor))
+	}
+	for name, expected := range spec.ConfigMap() {
+		if actual := description.Configs[name]; actual != expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s=%q, expected %q", name, actual, expected))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
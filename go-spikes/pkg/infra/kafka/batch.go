@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultBatchMaxWait = time.Second
+	// redeliverBackoff is the pause after a redelivered batch, doubled for every
+	// consecutive one up to maxRedeliverBackoff
+	redeliverBackoff    = 100 * time.Millisecond
+	maxRedeliverBackoff = 10 * time.Second
+)
+
+// ErrRedeliver is wrapped by a BatchConsumerPlugin whose batch failed transiently, e.g.
+// on a database outage. Rather than being rejected and committed, the batch is consumed
+// again from its first message, after a pause that grows while batches keep failing.
+var ErrRedeliver = errors.New("batch must be redelivered")
+
+// messageBatch accumulates polled messages until the batch is full or the first
+// message has waited maxWait.
+type messageBatch struct {
+	size     int
+	maxWait  time.Duration
+	messages []*k.Message
+	started  time.Time
+}
+
+func newMessageBatch(size int, maxWait time.Duration) *messageBatch {
+	return &messageBatch{
+		size:     size,
+		maxWait:  maxWait,
+		messages: make([]*k.Message, 0, size),
+	}
+}
+
+func (b *messageBatch) add(message *k.Message) {
+	if len(b.messages) == 0 {
+		b.started = time.Now()
+	}
+	b.messages = append(b.messages, message)
+}
+
+func (b *messageBatch) ready() bool {
+	if len(b.messages) == 0 {
+		return false
+	}
+	return len(b.messages) >= b.size || time.Since(b.started) >= b.maxWait
+}
+
+// pollTimeout shortens the poll so a partial batch is flushed close to its deadline.
+func (b *messageBatch) pollTimeout(defaultTimeout time.Duration) time.Duration {
+	if len(b.messages) == 0 {
+		return defaultTimeout
+	}
+	remaining := b.maxWait - time.Since(b.started)
+	if remaining <= 0 {
+		return time.Millisecond
+	}
+	return min(remaining, defaultTimeout)
+}
+
+func (b *messageBatch) take() []*k.Message {
+	messages := b.messages
+	b.messages = make([]*k.Message, 0, b.size)
+	return messages
+}
+
+// flushBatch hands the batch to the plugin under a single span and then stores the
+// offset after the last message of each partition once, for the committer. If the
+// handler fails, every message of the batch is rejected, unless it asks for the batch to
+// be redelivered. A batch with a message that could not be rejected is redelivered too.
+func (c *consumerJobImpl[T]) flushBatch(ctx context.Context, plugin BatchConsumerPlugin[T], messages []*k.Message) int {
+	if len(messages) == 0 {
+		return 0
+	}
+	// a batch of a multi-topic subscription may mix topics
+	topics := batchTopics(messages)
+	spanTopic := c.subscription
+	if len(topics) == 1 {
+		spanTopic = *messages[0].TopicPartition.Topic
+	}
+	ctx, span := tracing.StartSpanWithAttributes(
+		ctx,
+		"kafka.consumer.batch",
+		tracing.KafkaAttributes(spanTopic, "any", "process"),
+	)
+	defer span.End()
+	tracing.SetSpanAttributes(span, attribute.Int("messaging.batch.message_count", len(messages)))
+	log := logger.Ctx(ctx)
+
+	start := time.Now()
+	handled := len(messages)
+	err := plugin.ConsumeBatchHandler(ctx, c, messages)
+	recordBatchProcessing(messages, start)
+	if err != nil {
+		tracing.RecordError(span, err, "Failed to handle batch")
+		for topic := range topics {
+			recordConsumeError(topic, classifyHandlerError(err))
+		}
+		log.Error().Err(err).Int("size", len(messages)).Msg("Failed to handle batch")
+		if errors.Is(err, ErrRedeliver) {
+			if err = c.rewindBatch(messages); err != nil {
+				tracing.RecordError(span, err, "Failed to rewind batch")
+				log.Error().Err(err).Msg("Failed to rewind batch")
+			}
+			c.redeliveries++
+			c.redeliveryPause = min(redeliverBackoff<<min(c.redeliveries-1, 10), maxRedeliverBackoff)
+			return 0
+		}
+		for _, message := range messages {
+			if rejectErr := c.RejectMessage(ctx, message, err); rejectErr != nil {
+				// the batch is consumed again rather than committed without the message
+				log.Error().Err(rejectErr).Msg("Failed to reject message")
+				if rejectErr = c.rewindBatch(messages); rejectErr != nil {
+					tracing.RecordError(span, rejectErr, "Failed to rewind batch")
+					log.Error().Err(rejectErr).Msg("Failed to rewind batch")
+				}
+				return 0
+			}
+		}
+		handled = 0
+	}
+	c.redeliveries = 0
+	elapsed := time.Since(start).Seconds()
+	for topic, count := range topics {
+		metrics.KafkaConsumeBatchSize.WithLabelValues(topic).Observe(float64(count))
+		metrics.KafkaConsumeBatchDuration.WithLabelValues(topic).Observe(elapsed)
+	}
+	c.consumed.Add(int64(handled))
+
+	if err := c.commitBatch(messages); err != nil {
+		tracing.RecordError(span, err, "Failed to commit batch")
+		log.Error().Err(err).Msg("Failed to commit batch")
+	}
+	return handled
+}
+
+// awaitRedelivery holds the poll loop for the pause left by a redelivered batch, so a
+// failing dependency is not hit again at once. It returns false if ctx is done first.
+func (c *consumerJobImpl[T]) awaitRedelivery(ctx context.Context) bool {
+	if c.redeliveryPause == 0 {
+		return true
+	}
+	pause := c.redeliveryPause
+	c.redeliveryPause = 0
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(pause):
+		return true
+	}
+}
+
+// batchTopics counts the messages of each topic in a batch.
+func batchTopics(messages []*k.Message) map[string]int {
+	topics := make(map[string]int)
+	for _, message := range messages {
+		topics[*message.TopicPartition.Topic]++
+	}
+	return topics
+}
+
+// rewindBatch seeks every partition of the batch back to its first message. Its offsets
+// are not stored, so a job stopping now also consumes the batch again on restart.
+func (c *consumerJobImpl[T]) rewindBatch(messages []*k.Message) error {
+	first := make(map[string]k.TopicPartition)
+	for _, message := range messages {
+		label := partitionLabel(message.TopicPartition)
+		if current, ok := first[label]; !ok || message.TopicPartition.Offset < current.Offset {
+			first[label] = message.TopicPartition
+		}
+	}
+	partitions := make([]k.TopicPartition, 0, len(first))
+	for _, topicPartition := range first {
+		partitions = append(partitions, topicPartition)
+	}
+	if _, err := c.consumer.SeekPartitions(partitions); err != nil {
+		return fmt.Errorf("failed to rewind %d partitions: %w", len(partitions), err)
+	}
+	return nil
+}
+
+func (c *consumerJobImpl[T]) commitBatch(messages []*k.Message) error {
+	next := make(map[string]k.TopicPartition)
+	for _, message := range messages {
+		label := partitionLabel(message.TopicPartition)
+		if current, ok := next[label]; !ok || message.TopicPartition.Offset+1 > current.Offset {
+			topicPartition := message.TopicPartition
+			topicPartition.Offset = message.TopicPartition.Offset + 1
+			next[label] = topicPartition
+		}
+	}
+	offsets := make([]k.TopicPartition, 0, len(next))
+	for _, topicPartition := range next {
+		offsets = append(offsets, topicPartition)
+	}
+
+	if _, err := c.consumer.StoreOffsets(offsets); err != nil {
+		return fmt.Errorf("failed to store %d batch offsets: %w", len(offsets), err)
+	}
+	c.offsetsDone(offsets)
+	if c.committer != nil {
+		c.committer.stored(len(messages))
+		c.committer.commitDue()
+	}
+	return nil
+}
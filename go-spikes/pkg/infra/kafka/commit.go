@@ -0,0 +1,232 @@
+package kafka
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+)
+
+// asyncCommitQueue bounds the commits waiting for the async committer
+const asyncCommitQueue = 1024
+
+// offsetCommitter commits offsets according to ConsumerConfig.Commit when auto-commit
+// is off. A sync commit per message waits for the result, an async one is queued for a
+// background committer. Otherwise accepted messages only store their offset, and the
+// stored offsets are committed from the poll loop by commitDue.
+type offsetCommitter struct {
+	consumer *k.Consumer
+	// topic labels the metrics of commits that report no partitions, e.g. failed ones
+	topic    string
+	strategy string
+	every    int
+	interval time.Duration
+
+	// pending counts the messages stored since the last commit
+	pending atomic.Int64
+	// lastCommit is only used by the interval strategy, on the poll loop
+	lastCommit time.Time
+	commits    atomic.Int64
+	errors     atomic.Int64
+
+	// asyncOffsets queues the commits of the async committer goroutine, which runs them
+	// in order; nil commits every stored offset
+	asyncOffsets chan []k.TopicPartition
+	asyncDone    sync.WaitGroup
+	// asyncQueued counts the queued commits that have not completed yet. Commits are
+	// only queued from the poll loop.
+	asyncQueued sync.WaitGroup
+}
+
+// CommitStats counts a consumer's manual offset commits.
+type CommitStats struct {
+	Strategy string `json:"strategy"`
+	Commits  int64  `json:"commits"`
+	Errors   int64  `json:"errors"`
+}
+
+func newOffsetCommitter(consumer *k.Consumer, topic string, commit cfg.CommitConfig) *offsetCommitter {
+	strategy := commit.Strategy
+	if strategy == "" {
+		strategy = cfg.CommitSync
+	}
+	return &offsetCommitter{
+		consumer:   consumer,
+		topic:      topic,
+		strategy:   strategy,
+		every:      max(commit.EveryMessages, 1),
+		interval:   commit.Interval,
+		lastCommit: time.Now(),
+	}
+}
+
+// storesOffsets reports whether accepted messages store their offset for a later commit
+// rather than being committed one by one.
+func (o *offsetCommitter) storesOffsets() bool {
+	return o.strategy != cfg.CommitSync
+}
+
+func (o *offsetCommitter) start() {
+	if o.strategy != cfg.CommitAsync {
+		return
+	}
+	o.asyncOffsets = make(chan []k.TopicPartition, asyncCommitQueue)
+	o.asyncDone.Add(1)
+	go func() {
+		defer o.asyncDone.Done()
+		for offsets := range o.asyncOffsets {
+			var err error
+			if offsets == nil {
+				err = o.commit()
+			} else {
+				start := time.Now()
+				_, err = o.consumer.CommitOffsets(offsets)
+				o.observe(offsets, start, err)
+			}
+			if err != nil {
+				logger.Get().Error().Err(err).Str("strategy", o.strategy).Msg("Failed to commit offsets")
+			}
+			o.asyncQueued.Done()
+		}
+	}()
+}
+
+// enqueue hands a commit to the async committer without blocking the poll loop. When
+// the queue is full the commit is dropped; its offsets are stored, so they are committed
+// with the stored offsets instead.
+func (o *offsetCommitter) enqueue(offsets []k.TopicPartition) bool {
+	o.asyncQueued.Add(1)
+	select {
+	case o.asyncOffsets <- offsets:
+		return true
+	default:
+		o.asyncQueued.Done()
+		return false
+	}
+}
+
+// drain waits for the queued async commits, so that a commit made next is not
+// overtaken by an older one.
+func (o *offsetCommitter) drain() {
+	o.asyncQueued.Wait()
+}
+
+// accept commits or stores the offset after the message, for the per-message poll loop.
+func (o *offsetCommitter) accept(message *k.Message) error {
+	if !o.storesOffsets() {
+		start := time.Now()
+		_, err := o.consumer.CommitMessage(message)
+		o.observe([]k.TopicPartition{message.TopicPartition}, start, err)
+		return err
+	}
+	if _, err := o.consumer.StoreMessage(message); err != nil {
+		return err
+	}
+	if o.strategy == cfg.CommitAsync {
+		next := message.TopicPartition
+		next.Offset++
+		if o.enqueue([]k.TopicPartition{next}) {
+			return nil
+		}
+	}
+	o.stored(1)
+	return nil
+}
+
+// stored records offsets stored by the job itself, e.g. by the processor or a batch.
+func (o *offsetCommitter) stored(count int) {
+	o.pending.Add(int64(count))
+}
+
+// commitDue commits the stored offsets if the strategy says it is time. It is called
+// from the poll loop, so synchronous commits never run concurrently.
+func (o *offsetCommitter) commitDue() {
+	pending := o.pending.Load()
+	if pending == 0 {
+		return
+	}
+	var err error
+	switch o.strategy {
+	case cfg.CommitSync:
+		err = o.commit()
+	case cfg.CommitAsync:
+		// offsets stored by batches, concurrent workers or dropped commits
+		if o.enqueue(nil) {
+			o.pending.Store(0)
+		}
+	case cfg.CommitEveryMessages:
+		if pending >= int64(o.every) {
+			err = o.commit()
+		}
+	case cfg.CommitInterval:
+		if time.Since(o.lastCommit) >= o.interval {
+			o.lastCommit = time.Now()
+			err = o.commit()
+		}
+	}
+	if err != nil {
+		logger.Get().Error().Err(err).Str("strategy", o.strategy).Msg("Failed to commit stored offsets")
+	}
+}
+
+// commit commits every stored offset. A commit with nothing new to commit is not an error.
+func (o *offsetCommitter) commit() error {
+	o.pending.Store(0)
+	start := time.Now()
+	committed, err := o.consumer.Commit()
+	if kafkaErr, ok := err.(k.Error); ok && kafkaErr.Code() == k.ErrNoOffset {
+		return nil
+	}
+	o.observe(committed, start, err)
+	return err
+}
+
+// observe records a commit under the topics of its partitions.
+func (o *offsetCommitter) observe(partitions []k.TopicPartition, start time.Time, err error) {
+	elapsed := time.Since(start).Seconds()
+	topics := make(map[string]bool)
+	for _, partition := range partitions {
+		if partition.Topic != nil {
+			topics[*partition.Topic] = true
+		}
+	}
+	if len(topics) == 0 {
+		topics[o.topic] = true
+	}
+	if err != nil {
+		o.errors.Add(1)
+	} else {
+		o.commits.Add(1)
+	}
+	for topic := range topics {
+		if err != nil {
+			metrics.KafkaCommitErrors.WithLabelValues(topic, o.strategy).Inc()
+			recordConsumeError(topic, ConsumeErrorCommit)
+			continue
+		}
+		metrics.KafkaCommitLatency.WithLabelValues(topic, o.strategy).Observe(elapsed)
+	}
+}
+
+// stop waits for the async committer and commits whatever is still stored.
+func (o *offsetCommitter) stop() {
+	if o.asyncOffsets != nil {
+		close(o.asyncOffsets)
+		o.asyncDone.Wait()
+	}
+	if err := o.commit(); err != nil {
+		logger.Get().Error().Err(err).Str("strategy", o.strategy).Msg("Failed to commit offsets on stop")
+	}
+}
+
+func (o *offsetCommitter) stats() CommitStats {
+	return CommitStats{
+		Strategy: o.strategy,
+		Commits:  o.commits.Load(),
+		Errors:   o.errors.Load(),
+	}
+}
@@ -2,14 +2,18 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/infra-bed/go-spikes/pkg/config"
 	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
 	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
 	"github.com/infra-bed/go-spikes/pkg/model"
 	// CROSS-CUTTING START OF otel-tracing CONFIGURATION FOR kafka
 	"go.opentelemetry.io/otel"
@@ -21,23 +25,80 @@ type ConsumerJob[T any] interface {
 	Run(ctx context.Context)
 	Close()
 	AcceptMessage(ctx context.Context, message *k.Message) error
-	RejectMessage(ctx context.Context, message *k.Message) error
+	RejectMessage(ctx context.Context, message *k.Message, cause error) error
 	GetMetadata() (*k.Metadata, error)
 	GetPlugin() model.Plugin
 }
 
 func NewConsumerJob[T any](cfg cfg.KafkaConfig, plugin ConsumerPlugin[T]) (model.Job, error) {
+	job, err := newConsumerJob(cfg, plugin)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.ConsumerConfig.DeadLetter.Enabled {
+		return job, nil
+	}
+
+	if job.deadLetter, err = newDeadLetterPublisher(cfg); err != nil {
+		job.Close()
+		return nil, err
+	}
+	// each retry tier consumes the retry topics of its tier in its own group, sharing the
+	// publisher, which names them after the topic each message was consumed from
+	for i, delay := range cfg.ConsumerConfig.DeadLetter.RetryDelays {
+		tier := i + 1
+		retryCfg := cfg
+		retryCfg.Topic = cfg.RetryTopic(tier)
+		retryCfg.ConsumerConfig.Topics = cfg.RetryTopics(tier)
+		// retry topics always resume from their committed offsets
+		retryCfg.ConsumerConfig.StartFrom.Position = ""
+		retryCfg.ConsumerConfig.ConsumerGroup = fmt.Sprintf("%s.retry.%d", cfg.ConsumerConfig.ConsumerGroup, tier)
+		if retryCfg.ConsumerConfig.ClientId != "" {
+			retryCfg.ConsumerConfig.ClientId = fmt.Sprintf("%s-retry-%d", cfg.ConsumerConfig.ClientId, tier)
+		}
+		retryJob, err := newConsumerJob(retryCfg, plugin)
+		if err != nil {
+			job.Close()
+			return nil, err
+		}
+		retryJob.deadLetter = job.deadLetter
+		retryJob.retryTier = tier
+		retryJob.retryDelay = delay
+		job.retryJobs = append(job.retryJobs, retryJob)
+	}
+	return job, nil
+}
+
+func newConsumerJob[T any](cfg cfg.KafkaConfig, plugin ConsumerPlugin[T]) (*consumerJobImpl[T], error) {
 	var err error
 	var consumer *k.Consumer
 
-	kafkaConfig := &k.ConfigMap{
-		"bootstrap.servers":    strings.Join(cfg.Brokers, ","),
+	if err = cfg.ConsumerConfig.StartFrom.Validate(); err != nil {
+		return nil, err
+	}
+	if err = cfg.ConsumerConfig.Commit.Validate(); err != nil {
+		return nil, err
+	}
+	if len(cfg.ConsumerConfig.Routes) > 0 {
+		if plugin, err = routeByConfig(plugin, cfg.ConsumerConfig.Routes); err != nil {
+			return nil, err
+		}
+	}
+	kafkaConfig, err := newClientConfigMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]k.ConfigValue{
 		"client.id":            cfg.ConsumerConfig.ClientId,
 		"group.id":             cfg.ConsumerConfig.ConsumerGroup,
 		"auto.offset.reset":    cfg.ConsumerConfig.AutoOffsetReset,
 		"enable.auto.commit":   cfg.ConsumerConfig.AutoCommitEnabled,
 		"session.timeout.ms":   int(cfg.ConsumerConfig.SessionTimeout.Milliseconds()),
 		"max.poll.interval.ms": int(cfg.ConsumerConfig.MaxPollInterval.Milliseconds()),
+	} {
+		if err = kafkaConfig.SetKey(key, value); err != nil {
+			return nil, err
+		}
 	}
 	if int(cfg.ConsumerConfig.AutoCommitInterval.Milliseconds()) > 0 {
 		if err = kafkaConfig.SetKey("auto.commit.interval.ms", int(cfg.ConsumerConfig.AutoCommitInterval.Milliseconds())); err != nil {
@@ -49,6 +110,37 @@ func NewConsumerJob[T any](cfg cfg.KafkaConfig, plugin ConsumerPlugin[T]) (model
 			return nil, err
 		}
 	}
+	if cfg.ConsumerConfig.GroupInstanceId != "" {
+		if err = kafkaConfig.SetKey("group.instance.id", cfg.ConsumerConfig.GroupInstanceId); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ConsumerConfig.TopicRefreshInterval > 0 {
+		if err = kafkaConfig.SetKey("topic.metadata.refresh.interval.ms", int(cfg.ConsumerConfig.TopicRefreshInterval.Milliseconds())); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ConsumerConfig.PartitionAssignmentStrategy != "" {
+		if err = kafkaConfig.SetKey("partition.assignment.strategy", cfg.ConsumerConfig.PartitionAssignmentStrategy); err != nil {
+			return nil, err
+		}
+	}
+	batchPlugin, batching := plugin.(BatchConsumerPlugin[T])
+	if cfg.ConsumerConfig.Batch.Enabled && !batching {
+		logger.Get().Warn().Str("plugin", plugin.GetName()).Msg("Plugin does not support batches, consuming per message")
+	}
+	batching = batching && cfg.ConsumerConfig.Batch.Enabled
+	concurrent := !batching && cfg.ConsumerConfig.Concurrency.Workers > 1
+	storeOffsets := batching || concurrent
+	if !cfg.ConsumerConfig.AutoCommitEnabled {
+		storeOffsets = storeOffsets || !cfg.ConsumerConfig.Commit.IsSync()
+	}
+	if storeOffsets {
+		// offsets are stored once the message and all earlier ones are done
+		if err = kafkaConfig.SetKey("enable.auto.offset.store", false); err != nil {
+			return nil, err
+		}
+	}
 	consumer, err = k.NewConsumer(kafkaConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create consumer: %w", err)
@@ -59,23 +151,147 @@ func NewConsumerJob[T any](cfg cfg.KafkaConfig, plugin ConsumerPlugin[T]) (model
 		logBatchSize = config.DefaultLogBatchSize
 	}
 
-	return &consumerJobImpl[T]{
+	subscription := strings.Join(cfg.SubscriptionTopics(), ",")
+	job := &consumerJobImpl[T]{
 		consumer:         consumer,
 		connectionConfig: cfg,
+		subscription:     subscription,
 		plugin:           plugin,
 		// CROSS-CUTTING START OF otel-tracing CONFIGURATION FOR kafka
 		tracer: otel.Tracer("KafkaConsumer"),
 		// CROSS-CUTTING END OF otel-tracing CONFIGURATION FOR kafka
 		logBatchSize: logBatchSize,
-	}, nil
+		seeks:        make(chan seekRequest),
+		started:      make(map[string]bool),
+	}
+	if !cfg.ConsumerConfig.AutoCommitEnabled {
+		job.committer = newOffsetCommitter(consumer, subscription, cfg.ConsumerConfig.Commit)
+	}
+	if concurrent {
+		job.processor = newMessageProcessor(job, cfg.ConsumerConfig.Concurrency)
+	}
+	if batching {
+		size := cfg.ConsumerConfig.Batch.Size
+		if size <= 0 {
+			size = cfg.ConsumerConfig.MaxPollRecords
+		}
+		maxWait := cfg.ConsumerConfig.Batch.MaxWait
+		if maxWait <= 0 {
+			maxWait = defaultBatchMaxWait
+		}
+		job.batch = newMessageBatch(max(size, 1), maxWait)
+		job.batchPlugin = batchPlugin
+	}
+	return job, nil
+}
+
+// ConsumerResult summarises a consumer job while it runs and after it has finished.
+type ConsumerResult struct {
+	Topic             string           `json:"topic"`
+	ConsumerGroup     string           `json:"consumerGroup"`
+	MessagesConsumed  int64            `json:"messagesConsumed"`
+	RebalanceTimeline []RebalanceEvent `json:"rebalanceTimeline"`
+	MaxLag            int64            `json:"maxLag"`
+	LagTimeSeries     []LagSample      `json:"lagTimeSeries"`
+	RetryTiers        []ConsumerResult `json:"retryTiers,omitempty"`
+	Seeks             []SeekEvent      `json:"seeks,omitempty"`
+	Commits           *CommitStats     `json:"commits,omitempty"`
+	// Plugin is the result of plugins that report one, e.g. a delivery verification
+	Plugin interface{} `json:"plugin,omitempty"`
+	// MessagesPerSecondSinceSeek is the reprocessing throughput after the last seek
+	MessagesPerSecondSinceSeek float64 `json:"messagesPerSecondSinceSeek,omitempty"`
 }
 
 type consumerJobImpl[T any] struct {
 	consumer         *k.Consumer
 	connectionConfig cfg.KafkaConfig
-	plugin           ConsumerPlugin[T]
-	tracer           trace.Tracer
-	logBatchSize     int
+	// subscription labels metrics that belong to no single topic, such as idle polls
+	subscription string
+	plugin       ConsumerPlugin[T]
+	tracer       trace.Tracer
+	logBatchSize int
+	// deadLetter is nil unless ConsumerConfig.DeadLetter is enabled
+	deadLetter *deadLetterPublisher
+	// retryTier is the 1-based tier of a retry job, 0 for the main job
+	retryTier int
+	// retryDelay is how long a retry tier holds a message before handling it again
+	retryDelay time.Duration
+	retryJobs  []*consumerJobImpl[T]
+	// runCtx is the context of Run, used to parent spans started from client callbacks;
+	// it is nil until Run has started and guarded by runMu, as Seek reads it
+	runMu      sync.Mutex
+	runCtx     context.Context
+	consumed   atomic.Int64
+	resultMu   sync.Mutex
+	rebalances []RebalanceEvent
+	lagSamples []LagSample
+	maxLag     int64
+	// committer is nil when auto-commit is enabled
+	committer *offsetCommitter
+	// processor is nil unless ConsumerConfig.Concurrency has more than one worker
+	processor *messageProcessor[T]
+	// batch is nil unless ConsumerConfig.Batch is enabled and the plugin supports it
+	batch       *messageBatch
+	batchPlugin BatchConsumerPlugin[T]
+	// redeliveries counts the consecutive batches handed back with ErrRedeliver, and
+	// redeliveryPause is the pause still due before the next poll; poll loop only
+	redeliveries    int
+	redeliveryPause time.Duration
+	// seeks hands Seek requests to the poll loop
+	seeks      chan seekRequest
+	seekEvents []SeekEvent
+	// started holds the partitions already assigned at ConsumerConfig.StartFrom
+	started map[string]bool
+}
+
+func (c *consumerJobImpl[T]) GetResult() interface{} {
+	return c.result()
+}
+
+func (c *consumerJobImpl[T]) result() ConsumerResult {
+	c.resultMu.Lock()
+	defer c.resultMu.Unlock()
+
+	result := ConsumerResult{
+		Topic:             c.connectionConfig.Topic,
+		ConsumerGroup:     c.connectionConfig.ConsumerConfig.ConsumerGroup,
+		MessagesConsumed:  c.consumed.Load(),
+		RebalanceTimeline: append([]RebalanceEvent(nil), c.rebalances...),
+		MaxLag:            c.maxLag,
+		LagTimeSeries:     append([]LagSample(nil), c.lagSamples...),
+		Seeks:             append([]SeekEvent(nil), c.seekEvents...),
+	}
+	if c.committer != nil {
+		stats := c.committer.stats()
+		result.Commits = &stats
+	}
+	if len(c.seekEvents) > 0 {
+		last := c.seekEvents[len(c.seekEvents)-1]
+		if elapsed := time.Since(last.Time).Seconds(); elapsed > 0 {
+			result.MessagesPerSecondSinceSeek = float64(result.MessagesConsumed-last.ConsumedBefore) / elapsed
+		}
+	}
+	// retry tiers share the plugin, so only the main job reports its result
+	if reporter, ok := c.plugin.(model.ResultReporter); ok && c.retryTier == 0 {
+		result.Plugin = reporter.GetResult()
+	}
+	for _, retryJob := range c.retryJobs {
+		result.RetryTiers = append(result.RetryTiers, retryJob.result())
+	}
+	return result
+}
+
+// running returns the context of Run, or nil before Run has started.
+func (c *consumerJobImpl[T]) running() context.Context {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	return c.runCtx
+}
+
+func (c *consumerJobImpl[T]) recordRebalance(event RebalanceEvent) {
+	c.resultMu.Lock()
+	defer c.resultMu.Unlock()
+	c.rebalances = append(c.rebalances, event)
 }
 
 func (c *consumerJobImpl[T]) GetPlugin() model.Plugin {
@@ -84,6 +300,12 @@ func (c *consumerJobImpl[T]) GetPlugin() model.Plugin {
 
 func (c *consumerJobImpl[T]) Close() {
 	log := logger.Get()
+	for _, retryJob := range c.retryJobs {
+		retryJob.Close()
+	}
+	if c.deadLetter != nil && c.retryTier == 0 {
+		c.deadLetter.Close()
+	}
 	if err := c.consumer.Close(); err != nil {
 		log.Error().Err(err).Msg("Failed to close consumer")
 	} else {
@@ -97,9 +319,9 @@ func (c *consumerJobImpl[T]) AcceptMessage(ctx context.Context, message *k.Messa
 		log.Warn().Msg("Received nil message, cannot accept")
 		return nil
 	}
-	// commit manually, if not auto-commit enabled
-	if !c.connectionConfig.ConsumerConfig.AutoCommitEnabled {
-		if _, err := c.consumer.CommitMessage(message); err != nil {
+	// commit manually, if not auto-commit enabled and not tracked by the processor or batch
+	if c.processor == nil && c.batch == nil && c.committer != nil {
+		if err := c.committer.accept(message); err != nil {
 			log.Error().
 				Err(err).
 				Int32("partition", message.TopicPartition.Partition).
@@ -110,39 +332,139 @@ func (c *consumerJobImpl[T]) AcceptMessage(ctx context.Context, message *k.Messa
 	return nil
 }
 
-func (c *consumerJobImpl[T]) RejectMessage(ctx context.Context, message *k.Message) error {
+// RejectMessage sends the message to the next retry tier or the DLQ, and accepts it
+// once it has been delivered there. Without a dead letter config it is a no-op.
+func (c *consumerJobImpl[T]) RejectMessage(ctx context.Context, message *k.Message, cause error) error {
 	log := logger.Ctx(ctx)
 	if message == nil {
 		log.Warn().Msg("Received nil message, cannot reject")
 		return nil
 	}
-	return nil
+	if c.deadLetter == nil {
+		return nil
+	}
+	destination, err := c.deadLetter.Publish(ctx, message, cause)
+	if err != nil {
+		return fmt.Errorf("failed to reject message to %s: %w", destination, err)
+	}
+	log.Debug().
+		Str("destination", destination).
+		Int32("partition", message.TopicPartition.Partition).
+		Int64("offset", int64(message.TopicPartition.Offset)).
+		Msg("Rejected message")
+	return c.AcceptMessage(ctx, message)
+}
+
+// awaitRetryDelay holds a message read from a retry topic until its delay has passed.
+// Messages in a retry topic are in enqueue order, so blocking the tier is safe.
+func (c *consumerJobImpl[T]) awaitRetryDelay(ctx context.Context, message *k.Message) bool {
+	if c.retryDelay <= 0 {
+		return true
+	}
+	wait := time.Until(message.Timestamp.Add(c.retryDelay))
+	if wait <= 0 {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// handleMessage passes the message to the plugin, rejecting it if the plugin fails.
+// It is called from the poll loop, or from a worker when processing concurrently. The
+// message is not done if it must be consumed again: it was cut short by shutdown before
+// its handler ran, or it failed and could not be rejected.
+func (c *consumerJobImpl[T]) handleMessage(ctx context.Context, msg *k.Message) (handled, done bool) {
+	log := logger.Ctx(ctx)
+	if !c.awaitRetryDelay(ctx, msg) {
+		return false, false
+	}
+	start := time.Now()
+	err := c.plugin.ConsumeMessageHandler(ctx, c, msg)
+	recordProcessing(*msg.TopicPartition.Topic, start)
+	if err != nil {
+		errorType := classifyHandlerError(err)
+		recordConsumeError(*msg.TopicPartition.Topic, errorType)
+		log.Error().
+			Err(err).
+			Str("errorType", errorType).
+			Str("key", string(msg.Key)).
+			Int32("partition", msg.TopicPartition.Partition).
+			Int64("offset", int64(msg.TopicPartition.Offset)).
+			Msg("Failed to handle message")
+		if err = c.RejectMessage(ctx, msg, err); err != nil {
+			log.Error().Err(err).Msg("Failed to reject message")
+			return false, false
+		}
+		return false, true
+	}
+	c.consumed.Add(1)
+	return true, true
+}
+
+// offsetsDone passes the offsets up to which every message is handled to a plugin
+// that listens for them.
+func (c *consumerJobImpl[T]) offsetsDone(offsets []k.TopicPartition) {
+	if listener, ok := c.plugin.(OffsetListener); ok {
+		listener.OffsetsDone(offsets)
+	}
 }
 
 func (c *consumerJobImpl[T]) Run(ctx context.Context) {
 	log := logger.Ctx(ctx)
+	c.runMu.Lock()
+	c.runCtx = ctx
+	c.runMu.Unlock()
 
 	var msg *k.Message
 	var err error
 
+	topics := c.connectionConfig.SubscriptionTopics()
 	log.Info().
-		Str("topic", c.connectionConfig.Topic).
+		Any("topics", topics).
 		Str("group", c.connectionConfig.ConsumerConfig.ConsumerGroup).
 		Msg("Starting consumer")
 
+	if c.processor != nil {
+		c.processor.start()
+	}
+	if c.committer != nil {
+		c.committer.start()
+	}
+
 	count := 0
 	batchConsumeMsg := fmt.Sprintf("kafka.consume.batch: %d", c.logBatchSize)
 	intervalTimer := model.NewIntervalTimer(ctx, c.plugin)
 
-	if err = c.consumer.SubscribeTopics([]string{c.connectionConfig.Topic}, nil); err != nil {
+	if err = c.consumer.SubscribeTopics(topics, c.rebalanceCallback); err != nil {
 		log.Error().
 			Err(err).
-			Str("topic", c.connectionConfig.Topic).
+			Any("topics", topics).
 			Str("group", c.connectionConfig.ConsumerConfig.ConsumerGroup).
 			Msg("Failed to subscribe to topic")
 		return
 	}
 
+	// the retry tiers and the lag monitor stop with ctx; Run waits for them so that
+	// Close never closes a consumer they are still using
+	var background sync.WaitGroup
+	defer background.Wait()
+	for _, retryJob := range c.retryJobs {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			retryJob.Run(ctx)
+		}()
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		c.runLagMonitor(ctx, c.connectionConfig.ConsumerConfig.LagInterval)
+	}()
+
 	// CROSS-CUTTING START OF otel-tracing CONFIGURATION FOR kafka
 	batchCtx, batchSpan := c.tracer.Start(ctx, batchConsumeMsg)
 	batchLog := logger.Ctx(batchCtx)
@@ -153,6 +475,15 @@ func (c *consumerJobImpl[T]) Run(ctx context.Context) {
 		intervalTimer.NextTickWait()
 		select {
 		case <-ctx.Done():
+			if c.processor != nil {
+				c.processor.stop()
+			}
+			if c.batch != nil {
+				c.flushBatch(context.WithoutCancel(batchCtx), c.batchPlugin, c.batch.take())
+			}
+			if c.committer != nil {
+				c.committer.stop()
+			}
 			if msg != nil {
 				batchLog.Info().
 					Int("count", count).
@@ -162,14 +493,48 @@ func (c *consumerJobImpl[T]) Run(ctx context.Context) {
 			}
 			batchLog.Info().Int("count", count).Msg("consume context done")
 			return
+		case request := <-c.seeks:
+			c.applySeek(batchCtx, request)
 		default:
+			if c.committer != nil {
+				c.committer.commitDue()
+			}
+			if !c.awaitRedelivery(batchCtx) {
+				continue
+			}
 			batchLog.Trace().Msg("Consumer reading message")
-			msg, err = c.consumer.ReadMessage(100 * time.Millisecond)
+			pollTimeout := 100 * time.Millisecond
+			if c.batch != nil {
+				pollTimeout = c.batch.pollTimeout(pollTimeout)
+			}
+			pollStart := time.Now()
+			msg, err = c.consumer.ReadMessage(pollTimeout)
 			if err != nil {
-				if err.(k.Error).Code() == k.ErrTimedOut {
+				errorType, idle := classifyPollError(err)
+				if idle {
+					metrics.KafkaPollIdleSeconds.
+						WithLabelValues(c.subscription, c.connectionConfig.ConsumerConfig.ConsumerGroup).
+						Add(time.Since(pollStart).Seconds())
+					if c.batch != nil && c.batch.ready() {
+						c.flushBatch(batchCtx, c.batchPlugin, c.batch.take())
+					}
 					continue
 				}
-				batchLog.Error().Err(err).Msg("Error reading message")
+				// partition errors come with the message of their partition
+				errorTopic := c.subscription
+				if msg != nil && msg.TopicPartition.Topic != nil {
+					errorTopic = *msg.TopicPartition.Topic
+				}
+				recordConsumeError(errorTopic, errorType)
+				var kafkaErr k.Error
+				if errors.As(err, &kafkaErr) && kafkaErr.Code() == k.ErrMaxPollExceeded {
+					// the handler blocked the loop for too long; the next poll rejoins the group
+					batchLog.Warn().
+						Dur("maxPollInterval", c.connectionConfig.ConsumerConfig.MaxPollInterval).
+						Msg("Consumer left its group after exceeding max.poll.interval")
+					continue
+				}
+				batchLog.Error().Err(err).Str("errorType", errorType).Msg("Error reading message")
 				continue
 			}
 			if msg == nil {
@@ -177,14 +542,30 @@ func (c *consumerJobImpl[T]) Run(ctx context.Context) {
 					Msg("Received nil message, skipping")
 				continue
 			}
-			if err := c.plugin.ConsumeMessageHandler(batchCtx, c, msg); err != nil {
-				batchLog.Error().
-					Err(err).
-					Str("key", string(msg.Key)).
-					Int32("partition", msg.TopicPartition.Partition).
-					Int64("offset", int64(msg.TopicPartition.Offset)).
-					Msg("Failed to unmarshal payload")
-				continue
+			recordConsumed(msg)
+			if c.batch != nil {
+				// a retry tier holds each message for its delay before batching it
+				if !c.awaitRetryDelay(batchCtx, msg) {
+					continue
+				}
+				c.batch.add(msg)
+				if c.batch.ready() {
+					c.flushBatch(batchCtx, c.batchPlugin, c.batch.take())
+				}
+			} else if c.processor != nil {
+				if !c.processor.dispatch(batchCtx, msg) {
+					continue
+				}
+			} else {
+				handled, done := c.handleMessage(batchCtx, msg)
+				if done {
+					topicPartition := msg.TopicPartition
+					topicPartition.Offset++
+					c.offsetsDone([]k.TopicPartition{topicPartition})
+				}
+				if !handled {
+					continue
+				}
 			}
 			count++
 			if count%c.logBatchSize == 0 {
@@ -203,6 +584,12 @@ func (c *consumerJobImpl[T]) Run(ctx context.Context) {
 	}
 }
 
+// GetMetadata returns the metadata of the subscribed topic, or of every topic when the
+// job subscribes to several topics or a pattern.
 func (c *consumerJobImpl[T]) GetMetadata() (*k.Metadata, error) {
-	return c.consumer.GetMetadata(&c.connectionConfig.Topic, false, 5000)
+	topics := c.connectionConfig.SubscriptionTopics()
+	if len(topics) == 1 && !cfg.IsTopicPattern(topics[0]) {
+		return c.consumer.GetMetadata(&topics[0], false, 5000)
+	}
+	return c.consumer.GetMetadata(nil, true, 5000)
 }
@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/fibonacci"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+)
+
+const defaultLognormalSigma = 0.5
+
+// ProcessingCost simulates the per-message work of a consumer plugin.
+type ProcessingCost struct {
+	config cfg.ProcessingCostConfig
+	job    string
+	// rng is shared by concurrent workers
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewProcessingCost validates the cost model; job labels the stall metric.
+func NewProcessingCost(config cfg.ProcessingCostConfig, job string) (*ProcessingCost, error) {
+	switch config.Model {
+	case "":
+	case cfg.CostFixed, cfg.CostLognormal:
+		if config.Duration <= 0 {
+			return nil, fmt.Errorf("%s processing cost needs duration > 0", config.Model)
+		}
+	case cfg.CostUniform:
+		if config.MaxDuration < config.MinDuration {
+			return nil, fmt.Errorf("uniform processing cost needs maxDuration >= minDuration")
+		}
+	case cfg.CostFibonacci:
+		if config.FibonacciN <= 0 {
+			return nil, fmt.Errorf("fibonacci processing cost needs fibonacciN > 0")
+		}
+	default:
+		return nil, fmt.Errorf("unknown processing cost model %q", config.Model)
+	}
+	if config.Sigma <= 0 {
+		config.Sigma = defaultLognormalSigma
+	}
+	return &ProcessingCost{
+		config: config,
+		job:    job,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Apply spends the simulated cost of one message. Sleeps and stalls end early when ctx
+// is done; a stall blocks the caller, and with it the poll loop unless workers are used.
+func (p *ProcessingCost) Apply(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	stall := p.config.StallProbability > 0 && p.rng.Float64() < p.config.StallProbability
+	var sleep time.Duration
+	switch p.config.Model {
+	case cfg.CostFixed:
+		sleep = p.config.Duration
+	case cfg.CostUniform:
+		sleep = p.config.MinDuration + time.Duration(p.rng.Int63n(int64(p.config.MaxDuration-p.config.MinDuration)+1))
+	case cfg.CostLognormal:
+		mu := math.Log(float64(p.config.Duration))
+		sleep = time.Duration(math.Exp(mu + p.config.Sigma*p.rng.NormFloat64()))
+	}
+	p.mu.Unlock()
+
+	if p.config.Model == cfg.CostFibonacci {
+		fibonacci.DoFibonacciWithContext(ctx, p.config.FibonacciN)
+	}
+	if stall {
+		metrics.KafkaSimulatedStalls.WithLabelValues(p.job).Inc()
+		logger.Ctx(ctx).Warn().
+			Str("job", p.job).
+			Dur("stall", p.config.StallDuration).
+			Msg("Simulating a processing stall")
+		sleep += p.config.StallDuration
+	}
+	if sleep <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(sleep):
+	}
+}
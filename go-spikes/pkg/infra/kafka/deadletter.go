@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+// Headers carried by messages that were rejected to a retry topic or the DLQ.
+const (
+	HeaderError             = "x-error"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderAttempt           = "x-attempt"
+	HeaderReplayed          = "x-replayed"
+
+	deadLetterDeliveryWait  = 30 * time.Second
+	deadLetterReplayGroupID = ".dlq-replay"
+	// deadLetterReplayBackoff is the pause before a message that failed to replay is read again
+	deadLetterReplayBackoff = time.Second
+)
+
+// deadLetterPublisher moves rejected messages to the next retry tier, or to the DLQ
+// once every tier has been attempted. Each publish waits for the delivery report so
+// that the source offset is only committed once the message is safely stored.
+type deadLetterPublisher struct {
+	producer    *k.Producer
+	retryDelays []time.Duration
+}
+
+func newDeadLetterPublisher(kc cfg.KafkaConfig) (*deadLetterPublisher, error) {
+	configMap, err := newClientConfigMap(kc)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]k.ConfigValue{
+		"client.id":          kc.ConsumerConfig.ClientId + "-dlq",
+		"acks":               "all",
+		"enable.idempotence": true,
+	} {
+		if err = configMap.SetKey(key, value); err != nil {
+			return nil, err
+		}
+	}
+	producer, err := k.NewProducer(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead letter producer: %w", err)
+	}
+	return &deadLetterPublisher{
+		producer:    producer,
+		retryDelays: kc.ConsumerConfig.DeadLetter.RetryDelays,
+	}, nil
+}
+
+func (d *deadLetterPublisher) Close() {
+	d.producer.Flush(int(deadLetterDeliveryWait.Milliseconds()))
+	d.producer.Close()
+}
+
+// Publish sends the rejected message to its next destination and returns that topic.
+func (d *deadLetterPublisher) Publish(ctx context.Context, message *k.Message, cause error) (string, error) {
+	attempt, _ := strconv.Atoi(headerValue(message, HeaderAttempt))
+	originalTopic := headerValue(message, HeaderOriginalTopic)
+	originalPartition := headerValue(message, HeaderOriginalPartition)
+	originalOffset := headerValue(message, HeaderOriginalOffset)
+	if originalTopic == "" {
+		originalTopic = *message.TopicPartition.Topic
+		originalPartition = strconv.Itoa(int(message.TopicPartition.Partition))
+		originalOffset = strconv.FormatInt(int64(message.TopicPartition.Offset), 10)
+	}
+
+	attempt++
+	destination := cfg.DeadLetterTopic(originalTopic)
+	if attempt <= len(d.retryDelays) {
+		destination = cfg.RetryTopic(originalTopic, attempt)
+	}
+
+	headers := withoutDeadLetterHeaders(message.Headers)
+	headers = append(headers,
+		k.Header{Key: HeaderError, Value: []byte(cause.Error())},
+		k.Header{Key: HeaderOriginalTopic, Value: []byte(originalTopic)},
+		k.Header{Key: HeaderOriginalPartition, Value: []byte(originalPartition)},
+		k.Header{Key: HeaderOriginalOffset, Value: []byte(originalOffset)},
+		k.Header{Key: HeaderAttempt, Value: []byte(strconv.Itoa(attempt))},
+	)
+
+	if err := produceAndWait(ctx, d.producer, &k.Message{
+		TopicPartition: k.TopicPartition{Topic: &destination, Partition: k.PartitionAny},
+		Key:            message.Key,
+		Value:          message.Value,
+		Headers:        headers,
+	}); err != nil {
+		metrics.KafkaProduceErrors.WithLabelValues(destination, "dead_letter_failed").Inc()
+		return destination, err
+	}
+	metrics.KafkaRejectedMessages.WithLabelValues(originalTopic, destination).Inc()
+	return destination, nil
+}
+
+// produceAndWait produces a single message and blocks until its delivery report arrives.
+func produceAndWait(ctx context.Context, producer *k.Producer, message *k.Message) error {
+	deliveryChan := make(chan k.Event, 1)
+	if err := producer.Produce(message, deliveryChan); err != nil {
+		return fmt.Errorf("failed to produce to %s: %w", *message.TopicPartition.Topic, err)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(deadLetterDeliveryWait):
+		return fmt.Errorf("timed out waiting for delivery to %s", *message.TopicPartition.Topic)
+	case e := <-deliveryChan:
+		if delivered, ok := e.(*k.Message); ok && delivered.TopicPartition.Error != nil {
+			return fmt.Errorf("failed to deliver to %s: %w", *message.TopicPartition.Topic, delivered.TopicPartition.Error)
+		}
+		return nil
+	}
+}
+
+func headerValue(message *k.Message, key string) string {
+	for _, header := range message.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// deadLetterHeaders are the headers a rejection or replay sets; other headers, such as
+// those of the producer, are carried through retry tiers and the DLQ unchanged.
+var deadLetterHeaders = map[string]bool{
+	HeaderError:             true,
+	HeaderOriginalTopic:     true,
+	HeaderOriginalPartition: true,
+	HeaderOriginalOffset:    true,
+	HeaderAttempt:           true,
+	HeaderReplayed:          true,
+}
+
+func withoutDeadLetterHeaders(headers []k.Header) []k.Header {
+	var result []k.Header
+	for _, header := range headers {
+		if !deadLetterHeaders[header.Key] {
+			result = append(result, header)
+		}
+	}
+	return result
+}
+
+// NewDeadLetterReplayJob creates a job that reads the DLQs of the subscribed topics and republishes
+// every message to its original topic, dropping the retry attempt so it is handled afresh.
+func NewDeadLetterReplayJob(cfg cfg.KafkaConfig, plugin model.Plugin) (model.Job, error) {
+	consumerConfig, err := newClientConfigMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]k.ConfigValue{
+		"client.id":          cfg.ConsumerConfig.ClientId + deadLetterReplayGroupID,
+		"group.id":           cfg.ConsumerConfig.ConsumerGroup + deadLetterReplayGroupID,
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": false,
+	} {
+		if err = consumerConfig.SetKey(key, value); err != nil {
+			return nil, err
+		}
+	}
+	consumer, err := k.NewConsumer(consumerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead letter replay consumer: %w", err)
+	}
+
+	producerConfig, err := newClientConfigMap(cfg)
+	if err != nil {
+		consumer.Close()
+		return nil, err
+	}
+	if err = producerConfig.SetKey("acks", "all"); err != nil {
+		consumer.Close()
+		return nil, err
+	}
+	producer, err := k.NewProducer(producerConfig)
+	if err != nil {
+		consumer.Close()
+		return nil, fmt.Errorf("failed to create dead letter replay producer: %w", err)
+	}
+
+	return &deadLetterReplayJobImpl{
+		consumer: consumer,
+		producer: producer,
+		config:   cfg,
+		plugin:   plugin,
+	}, nil
+}
+
+type deadLetterReplayJobImpl struct {
+	consumer *k.Consumer
+	producer *k.Producer
+	config   cfg.KafkaConfig
+	plugin   model.Plugin
+}
+
+func (d *deadLetterReplayJobImpl) GetPlugin() model.Plugin {
+	return d.plugin
+}
+
+func (d *deadLetterReplayJobImpl) Close() {
+	log := logger.Get()
+	d.producer.Close()
+	if err := d.consumer.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close dead letter replay consumer")
+	} else {
+		log.Info().Msg("Dead letter replay job closed successfully")
+	}
+}
+
+func (d *deadLetterReplayJobImpl) Run(ctx context.Context) {
+	log := logger.Ctx(ctx)
+	dlqTopics := d.config.DeadLetterTopics()
+
+	if err := d.consumer.SubscribeTopics(dlqTopics, nil); err != nil {
+		log.Error().Err(err).Any("topics", dlqTopics).Msg("Failed to subscribe to dead letter topics")
+		return
+	}
+	log.Info().Any("topics", dlqTopics).Msg("Starting dead letter replay")
+
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Int("count", count).Msg("dead letter replay done")
+			return
+		default:
+		}
+
+		msg, err := d.consumer.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			errorType, idle := classifyPollError(err)
+			if idle {
+				continue
+			}
+			errorTopic := strings.Join(dlqTopics, ",")
+			if msg != nil && msg.TopicPartition.Topic != nil {
+				errorTopic = *msg.TopicPartition.Topic
+			}
+			recordConsumeError(errorTopic, errorType)
+			log.Error().Err(err).Str("errorType", errorType).Msg("Error reading dead letter message")
+			continue
+		}
+
+		targetTopic := headerValue(msg, HeaderOriginalTopic)
+		if targetTopic == "" {
+			targetTopic = d.config.Topic
+		}
+		// the original position is kept, so a replayed message that fails again is
+		// dead-lettered with it; the error and attempt are reset
+		headers := withoutDeadLetterHeaders(msg.Headers)
+		headers = append(headers, k.Header{Key: HeaderOriginalTopic, Value: []byte(targetTopic)})
+		for _, key := range []string{HeaderOriginalPartition, HeaderOriginalOffset} {
+			if value := headerValue(msg, key); value != "" {
+				headers = append(headers, k.Header{Key: key, Value: []byte(value)})
+			}
+		}
+		headers = append(headers, k.Header{Key: HeaderReplayed, Value: []byte(time.Now().UTC().Format(time.RFC3339))})
+		if err = produceAndWait(ctx, d.producer, &k.Message{
+			TopicPartition: k.TopicPartition{Topic: &targetTopic, Partition: k.PartitionAny},
+			Key:            msg.Key,
+			Value:          msg.Value,
+			Headers:        headers,
+		}); err != nil {
+			log.Error().
+				Err(err).
+				Int32("partition", msg.TopicPartition.Partition).
+				Int64("offset", int64(msg.TopicPartition.Offset)).
+				Msg("Failed to replay dead letter message")
+			metrics.KafkaProduceErrors.WithLabelValues(targetTopic, "dead_letter_replay_failed").Inc()
+			// committing a later message would skip this one, so it is read again instead
+			if err = d.consumer.Seek(msg.TopicPartition, 0); err != nil {
+				log.Error().Err(err).Msg("Failed to seek back to dead letter message, stopping replay")
+				return
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(deadLetterReplayBackoff):
+			}
+			continue
+		}
+		if _, err = d.consumer.CommitMessage(msg); err != nil {
+			log.Error().Err(err).Msg("Failed to commit replayed dead letter message")
+		}
+		metrics.KafkaDeadLetterReplayed.WithLabelValues(targetTopic).Inc()
+		count++
+	}
+}
@@ -3,7 +3,11 @@ package entityrepo
 import (
 	"context"
 	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
 
+	kafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	k "github.com/infra-bed/go-spikes/pkg/config/kafka"
 	"github.com/infra-bed/go-spikes/pkg/logger"
 )
@@ -15,67 +19,251 @@ type PayloadSpecs struct {
 }
 
 type Payload struct {
+	// Version is the payload schema version; v1 producers omit it
+	Version    int `json:",omitempty"`
 	EntityID   string
 	Attributes map[string]interface{}
+	// Deleted marks a delete event, produced as a tombstone keyed by EntityID.
+	Deleted bool `json:"-"`
+	// ProducerRunID and Sequence number each entity's events per producer run, so the
+	// consumer can detect lost, duplicated and reordered messages.
+	ProducerRunID string
+	Sequence      int64
 }
 
-func createPayload(specs PayloadSpecs) (Payload, error) {
+// MessageKey keys every event by its entity so that compaction keeps the latest state.
+func (p Payload) MessageKey() []byte {
+	return []byte(p.EntityID)
+}
+
+func (p Payload) IsTombstone() bool {
+	return p.Deleted
+}
+
+func (p Payload) MessageHeaders() []kafka.Header {
+	return []kafka.Header{
+		{Key: HeaderProducerRun, Value: []byte(p.ProducerRunID)},
+		{Key: HeaderSequence, Value: []byte(strconv.FormatInt(p.Sequence, 10))},
+	}
+}
+
+const (
+	defaultZipfS = 1.1
+	defaultZipfV = 1
+)
+
+// timestampEpoch anchors generated timestamps, so that they are reproducible from the seed.
+var timestampEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// generator picks the entity of every event and generates its attributes. All choices
+// come from one seeded source, so a seed reproduces the same sequence of payloads.
+type generator struct {
+	cfg  k.ProducerPluginConfig
+	seed int64
+	rng  *rand.Rand
+	zipf *rand.Zipf
+	// entityCount grows with new entities; indexes run from 1 to entityCount
+	entityCount int
+	// cursor is the last entity picked by the sequential distribution
+	cursor int
+	// attributeCounts fixes the attribute count of each entity the first time it is seen
+	attributeCounts map[int]int
+	attributeTypes  []string
+}
+
+func newGenerator(cfg k.ProducerPluginConfig) (*generator, error) {
+	genCfg := cfg.Generator
+	switch genCfg.KeyDistribution {
+	case "", k.KeysSequential, k.KeysUniform:
+	case k.KeysZipfian:
+		if genCfg.ZipfS == 0 {
+			genCfg.ZipfS = defaultZipfS
+		}
+		if genCfg.ZipfV == 0 {
+			genCfg.ZipfV = defaultZipfV
+		}
+		if genCfg.ZipfS <= 1 || genCfg.ZipfV < 1 {
+			return nil, fmt.Errorf("zipfian keys need zipfS > 1 and zipfV >= 1")
+		}
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q", genCfg.KeyDistribution)
+	}
+	if genCfg.NewEntityRate < 0 || genCfg.NewEntityRate > 1 {
+		return nil, fmt.Errorf("newEntityRate must be between 0 and 1")
+	}
+	if genCfg.V2Ratio < 0 || genCfg.V2Ratio > 1 {
+		return nil, fmt.Errorf("v2Ratio must be between 0 and 1")
+	}
+	if genCfg.MinAttributeCount > cfg.AttributeCount {
+		return nil, fmt.Errorf("minAttributeCount must not exceed attributeCount")
+	}
+	attributeTypes := genCfg.AttributeTypes
+	if len(attributeTypes) == 0 {
+		attributeTypes = []string{k.AttributeString}
+	}
+	for _, attributeType := range attributeTypes {
+		switch attributeType {
+		case k.AttributeString, k.AttributeInt, k.AttributeFloat, k.AttributeBool,
+			k.AttributeTimestamp, k.AttributeObject, k.AttributeArray:
+		default:
+			return nil, fmt.Errorf("unknown attribute type %q", attributeType)
+		}
+	}
+	cfg.Generator = genCfg
+
+	seed := genCfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	g := &generator{
+		cfg:             cfg,
+		seed:            seed,
+		rng:             rand.New(rand.NewSource(seed)),
+		entityCount:     cfg.EntityCount,
+		attributeCounts: make(map[int]int),
+		attributeTypes:  attributeTypes,
+	}
+	g.resetZipf()
+	return g, nil
+}
+
+// resetZipf spans the zipfian distribution over the current entities, entity 1 being
+// the hottest.
+func (g *generator) resetZipf() {
+	if g.cfg.Generator.KeyDistribution == k.KeysZipfian {
+		g.zipf = rand.NewZipf(g.rng, g.cfg.Generator.ZipfS, g.cfg.Generator.ZipfV, uint64(g.entityCount-1))
+	}
+}
+
+// nextEntity returns the index of the entity of the next event.
+func (g *generator) nextEntity() int {
+	if g.cfg.Generator.NewEntityRate > 0 && g.rng.Float64() < g.cfg.Generator.NewEntityRate {
+		g.entityCount++
+		g.resetZipf()
+		return g.entityCount
+	}
+	switch g.cfg.Generator.KeyDistribution {
+	case k.KeysUniform:
+		return g.rng.Intn(g.entityCount) + 1
+	case k.KeysZipfian:
+		return int(g.zipf.Uint64()) + 1
+	default:
+		g.cursor = g.cursor%g.entityCount + 1
+		return g.cursor
+	}
+}
+
+func (g *generator) attributeCount(entityIdx int) int {
+	count, ok := g.attributeCounts[entityIdx]
+	if !ok {
+		count = g.cfg.AttributeCount
+		if minCount := g.cfg.Generator.MinAttributeCount; minCount > 0 {
+			count = minCount + g.rng.Intn(g.cfg.AttributeCount-minCount+1)
+		}
+		g.attributeCounts[entityIdx] = count
+	}
+	return count
+}
+
+// attributeValue generates the value of attribute i; its type depends only on i, so an
+// attribute keeps its type across entities and events.
+func (g *generator) attributeValue(specs PayloadSpecs, i int) interface{} {
+	switch g.attributeTypes[i%len(g.attributeTypes)] {
+	case k.AttributeInt:
+		return g.rng.Int63n(1_000_000)
+	case k.AttributeFloat:
+		return g.rng.Float64() * 1000
+	case k.AttributeBool:
+		return g.rng.Intn(2) == 1
+	case k.AttributeTimestamp:
+		offset := time.Duration(specs.IterIdx)*time.Second + time.Duration(g.rng.Int63n(int64(time.Second)))
+		return timestampEpoch.Add(offset).Format(time.RFC3339Nano)
+	case k.AttributeObject:
+		return map[string]interface{}{
+			"id":     g.rng.Int63n(1_000_000),
+			"name":   fmt.Sprintf("name-%d-%d", specs.EntityIdx, g.rng.Intn(100)),
+			"active": g.rng.Intn(2) == 1,
+		}
+	case k.AttributeArray:
+		values := make([]int64, 1+g.rng.Intn(5))
+		for j := range values {
+			values[j] = g.rng.Int63n(1000)
+		}
+		return values
+	default:
+		return fmt.Sprintf("value-%d-%d-%d", specs.EntityIdx, specs.IterIdx, i)
+	}
+}
+
+func (g *generator) createDeletePayload(specs PayloadSpecs) Payload {
+	return Payload{
+		EntityID: fmt.Sprintf("entity-%d", specs.EntityIdx),
+		Deleted:  true,
+	}
+}
+
+func (g *generator) createPayload(specs PayloadSpecs) Payload {
 	payload := Payload{
 		EntityID:   fmt.Sprintf("entity-%d", specs.EntityIdx),
-		Attributes: make(map[string]interface{}),
+		Attributes: make(map[string]interface{}, specs.AttributeCount),
 	}
-
 	for i := 0; i < specs.AttributeCount; i++ {
-		attrKey := fmt.Sprintf("attr-%d", i)
-		attrValue := fmt.Sprintf("value-%d-%d-%d", specs.EntityIdx, specs.IterIdx, i)
-		payload.Attributes[attrKey] = attrValue
+		payload.Attributes[fmt.Sprintf("attr-%d", i)] = g.attributeValue(specs, i)
 	}
+	return payload
+}
 
-	return payload, nil
+// next generates the payload of the iterIdx-th event.
+func (g *generator) next(iterIdx int) Payload {
+	entityIdx := g.nextEntity()
+	specs := PayloadSpecs{
+		EntityIdx:      entityIdx,
+		IterIdx:        iterIdx,
+		AttributeCount: g.attributeCount(entityIdx),
+	}
+	if g.cfg.DeleteRatio > 0 && g.rng.Float64() < g.cfg.DeleteRatio {
+		return g.createDeletePayload(specs)
+	}
+	payload := g.createPayload(specs)
+	if g.cfg.Generator.V2Ratio > 0 && g.rng.Float64() < g.cfg.Generator.V2Ratio {
+		toV2(&payload)
+	}
+	return payload
 }
 
-func GeneratePayloads(ctx context.Context, cfg k.ProducerPluginConfig) (<-chan Payload, error) {
+// GeneratePayloads stamps every payload with runID and the entity's next sequence number.
+func GeneratePayloads(ctx context.Context, cfg k.ProducerPluginConfig, runID string) (<-chan Payload, error) {
 	if cfg.EntityCount <= 0 || cfg.AttributeCount <= 0 {
 		return nil, fmt.Errorf("invalid configuration: all counts must be greater than zero")
 	}
+	gen, err := newGenerator(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generator configuration: %w", err)
+	}
 	log := logger.Ctx(ctx)
+	log.Info().
+		Int64("seed", gen.seed).
+		Str("keyDistribution", cfg.Generator.KeyDistribution).
+		Msg("Generating payloads")
 	payloads := make(chan Payload)
 
 	go func() {
-		var iterIdx int
-		var entityIdx int
+		sequences := make(map[string]int64)
 		defer func() {
 			close(payloads)
 			log.Info().Msg("Generator closed successfully")
 		}()
-		for {
-			entityIdx++
+		for iterIdx := 0; ; iterIdx++ {
+			payload := gen.next(iterIdx)
+			sequences[payload.EntityID]++
+			payload.ProducerRunID = runID
+			payload.Sequence = sequences[payload.EntityID]
 			select {
 			case <-ctx.Done():
 				log.Info().Msg("payload-generation done")
 				return
-			default:
-				specs := PayloadSpecs{
-					EntityIdx:      entityIdx,
-					IterIdx:        iterIdx,
-					AttributeCount: cfg.AttributeCount,
-				}
-				payload, err := createPayload(specs)
-				if err != nil {
-					fmt.Printf(
-						"Error creating payload for entity %d, iteration %d: %v\n",
-						entityIdx, iterIdx, err,
-					)
-					continue
-				}
-				payloads <- payload
-			}
-			if entityIdx < cfg.EntityCount {
-				entityIdx++
-			} else {
-				entityIdx = 0
+			case payloads <- payload:
 			}
-			iterIdx++
 		}
 	}()
 
@@ -3,19 +3,33 @@ package entityrepo
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/google/uuid"
 	"github.com/infra-bed/go-spikes/pkg/config"
 	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
 	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/infra/sqlsink"
 	"github.com/infra-bed/go-spikes/pkg/logger"
 )
 
 type ProducerPlugin struct {
 	pluginCfg    cfg.ProducerPluginConfig
+	runID        string
 	counter      int
+	deleteCount  int
 	logBatchSize int
+	// mu guards the delivery state below, which is read by the consumer's result
+	mu sync.Mutex
+	// lastAcked is the latest acknowledged state per entity; deleted entities keep a
+	// Deleted payload
+	lastAcked map[string]*Payload
+	// acks tracks the acknowledged sequences per producer run and entity
+	acks map[string]*sequenceTracker
 }
 
 func (p *ProducerPlugin) GetName() string {
@@ -29,7 +43,10 @@ func NewProducerPlugin(pluginCfg cfg.ProducerPluginConfig) *ProducerPlugin {
 	}
 	return &ProducerPlugin{
 		pluginCfg:    pluginCfg,
+		runID:        uuid.New().String(),
 		logBatchSize: logBatchSize,
+		lastAcked:    make(map[string]*Payload),
+		acks:         make(map[string]*sequenceTracker),
 	}
 }
 
@@ -49,13 +66,37 @@ func (p *ProducerPlugin) ProduceMessageListener(ctx context.Context, engine infr
 	var err error
 	var payload Payload
 	log := logger.WithContext(ctx)
-	if err = json.Unmarshal(msg.Value, &payload); err != nil {
-		return err
+	if msg.Value != nil {
+		if err = json.Unmarshal(msg.Value, &payload); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if msg.Value == nil {
+		payload.EntityID = string(msg.Key)
+		payload.Deleted = true
+		p.deleteCount++
+	}
+	entityID := payload.EntityID
+	payload.ProducerRunID, payload.Sequence = messageSequence(msg, &payload)
+	if payload.ProducerRunID != "" {
+		key := sequenceKey(payload.ProducerRunID, entityID)
+		if _, ok := p.acks[key]; !ok {
+			p.acks[key] = &sequenceTracker{}
+		}
+		p.acks[key].observe(payload.Sequence)
+	}
+	// acks may arrive out of order after retries; keep the latest state
+	if last, ok := p.lastAcked[entityID]; !ok || payload.Sequence >= last.Sequence {
+		p.lastAcked[entityID] = &payload
 	}
 	p.counter++
 	if p.counter%p.logBatchSize == 0 {
 		log.Info().
 			Int("produceCount", p.counter).
+			Int("deleteCount", p.deleteCount).
 			Int64("offset", int64(msg.TopicPartition.Offset)).
 			Msg("produced payloads")
 	}
@@ -63,52 +104,302 @@ func (p *ProducerPlugin) ProduceMessageListener(ctx context.Context, engine infr
 }
 
 func (p *ProducerPlugin) Payloads(ctx context.Context) (<-chan Payload, error) {
-	return GeneratePayloads(ctx, p.pluginCfg)
+	return GeneratePayloads(ctx, p.pluginCfg, p.runID)
 }
 
 type ConsumerPlugin struct {
-	entities     map[string]*Payload
+	// mu guards the state below, as messages may be handled by concurrent workers
+	mu           sync.Mutex
+	store        StateStore
 	pluginCfg    cfg.ConsumerPluginConfig
 	counter      int
+	deleteCount  int
+	skipped      int
 	logBatchSize int
+	verifier     *SequenceVerifier
+	schema       *schemaDecoder
+	cost         *infra.ProcessingCost
+	// producer, when set, cross-checks the sequences against its delivery acks
+	producer *ProducerPlugin
+	// sink, when set, receives every entity change before it is applied
+	sink sqlsink.Sink
+	// restored is set when the store started with entities of an earlier run
+	restored bool
+	// stateCheck is the convergence check, once both jobs have finished
+	stateCheck *StateCheck
 }
 
 func (c *ConsumerPlugin) GetName() string {
 	return c.pluginCfg.JobName
 }
 
-func NewConsumerPlugin(pluginCfg cfg.ConsumerPluginConfig) *ConsumerPlugin {
+func NewConsumerPlugin(pluginCfg cfg.ConsumerPluginConfig) (*ConsumerPlugin, error) {
 	logBatchSize := pluginCfg.LogBatchSize
 	if logBatchSize <= 0 {
 		logBatchSize = config.DefaultLogBatchSize
 	}
+	cost, err := infra.NewProcessingCost(pluginCfg.ProcessingCost, pluginCfg.JobName)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := newSchemaDecoder(pluginCfg.SchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewStateStore(pluginCfg.StateStore)
+	if err != nil {
+		return nil, err
+	}
 	return &ConsumerPlugin{
-		entities:     make(map[string]*Payload),
+		store:        store,
 		pluginCfg:    pluginCfg,
 		logBatchSize: logBatchSize,
+		verifier:     NewSequenceVerifier(),
+		schema:       schema,
+		cost:         cost,
+		restored:     store.Len() > 0,
+	}, nil
+}
+
+// StoredOffsets returns the offsets the restored state store resumes from, empty when the
+// store is new or not durable.
+func (c *ConsumerPlugin) StoredOffsets() []cfg.PartitionOffset {
+	return c.store.Offsets()
+}
+
+// OffsetsDone marks the offsets up to which the consumer has handled every message, so
+// a restored store never resumes past a message still in flight on another worker.
+func (c *ConsumerPlugin) OffsetsDone(offsets []k.TopicPartition) {
+	for _, offset := range offsets {
+		if err := c.store.MarkOffset(*offset.Topic, offset.Partition, int64(offset.Offset)); err != nil {
+			logger.Get().Error().Err(err).Msg("Failed to snapshot state store")
+		}
+	}
+}
+
+// SinkTo writes the consumed entities to sink. Batches it fails to write are consumed
+// again, so the consumer should run in batch mode.
+func (c *ConsumerPlugin) SinkTo(sink sqlsink.Sink) {
+	c.sink = sink
+}
+
+// Close snapshots and closes the state store, and the sink, once the consumer job has
+// finished.
+func (c *ConsumerPlugin) Close() error {
+	err := c.store.Close()
+	if c.sink != nil {
+		err = errors.Join(err, c.sink.Close())
+	}
+	return err
+}
+
+// CrossCheck makes the sequence report compare what was consumed with the deliveries
+// the producer had acknowledged.
+func (c *ConsumerPlugin) CrossCheck(producer *ProducerPlugin) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.producer = producer
+}
+
+// ConsumerReport is the result of an entity-repo consumer.
+type ConsumerReport struct {
+	// Skipped counts the messages of topics routed to the skip handler
+	Skipped   int            `json:"skipped,omitempty"`
+	Sequences SequenceReport `json:"sequences"`
+	Schema    SchemaReport   `json:"schema"`
+	Sink      *sqlsink.Stats `json:"sink,omitempty"`
+	// StateCheck is set once the convergence check has run
+	StateCheck *StateCheck `json:"stateCheck,omitempty"`
+}
+
+func (c *ConsumerPlugin) GetResult() interface{} {
+	c.mu.Lock()
+	skipped, stateCheck := c.skipped, c.stateCheck
+	c.mu.Unlock()
+	report := ConsumerReport{
+		Skipped:    skipped,
+		Sequences:  c.SequenceReport(),
+		Schema:     c.SchemaReport(),
+		StateCheck: stateCheck,
 	}
+	if c.sink != nil {
+		stats := c.sink.Stats()
+		report.Sink = &stats
+	}
+	return report
+}
+
+// SchemaReport returns the payload versions handled and the compatibility failures.
+func (c *ConsumerPlugin) SchemaReport() SchemaReport {
+	return c.schema.report()
+}
+
+// SequenceReport returns the loss, duplication and ordering report of the consumed messages.
+func (c *ConsumerPlugin) SequenceReport() SequenceReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.producer == nil {
+		return c.verifier.Report()
+	}
+	c.producer.mu.Lock()
+	defer c.producer.mu.Unlock()
+	return c.verifier.report(c.producer.acks)
 }
 
 func (c *ConsumerPlugin) ConsumeMessageHandler(ctx context.Context, engine infra.ConsumerJob[Payload], msg *k.Message) error {
 	var err error
-	var payload Payload
+	var payload *Payload
 	log := logger.WithContext(ctx)
-	if err := json.Unmarshal(msg.Value, &payload); err != nil {
+	if msg.Value != nil {
+		var version int
+		payload, version, err = c.schema.decode(msg)
+		c.schema.count(msg, version, err)
+		if err != nil {
+			return fmt.Errorf("%w: %w", infra.ErrDeserialize, err)
+		}
+	}
+	c.cost.Apply(ctx)
+	if err = c.writeSink(ctx, []*k.Message{msg}, []*Payload{payload}); err != nil {
 		return err
 	}
-	c.entities[payload.EntityID] = &payload
+
+	c.mu.Lock()
+	c.apply(ctx, msg, payload)
+	c.mu.Unlock()
+
 	if err = engine.AcceptMessage(ctx, msg); err != nil {
 		log.Error().Err(err).Msg("Failed to commit message")
 	}
+	return nil
+}
+
+// TopicHandlers names the handlers consumer.routes can send topics to: "apply"
+// materializes the messages as ConsumeMessageHandler does, and "skip" only accepts them,
+// e.g. for topics of a fan-in subscription that carry no entities.
+func (c *ConsumerPlugin) TopicHandlers() map[string]infra.MessageHandler[Payload] {
+	return map[string]infra.MessageHandler[Payload]{
+		"apply": c.ConsumeMessageHandler,
+		"skip":  c.skip,
+	}
+}
+
+func (c *ConsumerPlugin) skip(ctx context.Context, engine infra.ConsumerJob[Payload], msg *k.Message) error {
+	c.mu.Lock()
+	c.skipped++
+	c.mu.Unlock()
+	if err := engine.AcceptMessage(ctx, msg); err != nil {
+		logger.WithContext(ctx).Error().Err(err).Msg("Failed to commit message")
+	}
+	return nil
+}
+
+// ConsumeBatchHandler applies the whole batch under a single lock. Payloads that
+// cannot be decoded are rejected on their own; the consumer commits the batch. With a
+// sink, the batch is written first and redelivered if the write fails.
+func (c *ConsumerPlugin) ConsumeBatchHandler(ctx context.Context, engine infra.ConsumerJob[Payload], messages []*k.Message) error {
+	payloads := make([]*Payload, len(messages))
+	versions := make([]int, len(messages))
+	decodeErrs := make([]error, len(messages))
+	for i, msg := range messages {
+		if msg.Value != nil {
+			payloads[i], versions[i], decodeErrs[i] = c.schema.decode(msg)
+		}
+	}
+	for range messages {
+		c.cost.Apply(ctx)
+	}
+	if err := c.writeSink(ctx, messages, payloads); err != nil {
+		return fmt.Errorf("%w: %w", infra.ErrRedeliver, err)
+	}
+	// a redelivered batch is decoded again, so it is only counted once handled
+	for i, msg := range messages {
+		c.schema.count(msg, versions[i], decodeErrs[i])
+	}
+	for i, msg := range messages {
+		if decodeErrs[i] == nil {
+			continue
+		}
+		if err := engine.RejectMessage(ctx, msg, decodeErrs[i]); err != nil {
+			logger.WithContext(ctx).Error().Err(err).Msg("Failed to reject message")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, msg := range messages {
+		if msg.Value != nil && payloads[i] == nil {
+			continue
+		}
+		c.apply(ctx, msg, payloads[i])
+	}
+	return nil
+}
+
+// writeSink writes the messages that were decoded, or are tombstones, to the sink.
+func (c *ConsumerPlugin) writeSink(ctx context.Context, messages []*k.Message, payloads []*Payload) error {
+	if c.sink == nil {
+		return nil
+	}
+	records := make([]sqlsink.Record, 0, len(messages))
+	for i, msg := range messages {
+		runID, sequence := messageSequence(msg, payloads[i])
+		record := sqlsink.Record{
+			EntityID:  string(msg.Key),
+			Partition: msg.TopicPartition.Partition,
+			Offset:    int64(msg.TopicPartition.Offset),
+			RunID:     runID,
+			Sequence:  sequence,
+			Timestamp: msg.Timestamp,
+		}
+		if msg.Value != nil {
+			if payloads[i] == nil {
+				continue
+			}
+			value, err := json.Marshal(payloads[i])
+			if err != nil {
+				return fmt.Errorf("failed to encode payload of %s: %w", payloads[i].EntityID, err)
+			}
+			record.EntityID = payloads[i].EntityID
+			record.Value = value
+		}
+		records = append(records, record)
+	}
+	return c.sink.Write(ctx, records)
+}
+
+// apply updates the materialized state with a message; the caller holds mu.
+func (c *ConsumerPlugin) apply(ctx context.Context, msg *k.Message, payload *Payload) {
+	log := logger.WithContext(ctx)
+	entityID := string(msg.Key)
+	var err error
+	if msg.Value == nil {
+		// tombstone: the key is the entity id
+		err = c.store.Delete(entityID)
+		c.deleteCount++
+	} else {
+		entityID = payload.EntityID
+		err = c.store.Put(&Entity{
+			ID:        entityID,
+			Payload:   payload,
+			Partition: msg.TopicPartition.Partition,
+			Offset:    int64(msg.TopicPartition.Offset),
+			UpdatedAt: time.Now(),
+		})
+	}
+	if err != nil {
+		log.Error().Err(err).Str("entityId", entityID).Msg("Failed to update state store")
+	}
+	runID, sequence := messageSequence(msg, payload)
+	c.verifier.Observe(runID, entityID, sequence)
 	c.counter++
 	if c.counter%c.logBatchSize == 0 {
 		log.Info().
 			Int("consumeCount", c.counter).
-			Int("entityCount", len(c.entities)).
+			Int("deleteCount", c.deleteCount).
+			Int("entityCount", c.store.Len()).
 			Int64("offset", int64(msg.TopicPartition.Offset)).
 			Msg("consumed payloads")
 	}
-	return nil
 }
 
 func (c *ConsumerPlugin) GetInitialDelayDuration() time.Duration {
@@ -0,0 +1,124 @@
+package entityrepo
+
+import (
+	"encoding/json"
+	"sort"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+)
+
+// EntityPage is a page of the materialized entities, ordered by id; Page starts at 1.
+type EntityPage struct {
+	Page     int       `json:"page"`
+	PageSize int       `json:"pageSize"`
+	Total    int       `json:"total"`
+	Entities []*Entity `json:"entities"`
+}
+
+// AttributeStats describes one attribute across the materialized entities:
+// * Entities - how many entities have the attribute
+// * Cardinality - how many distinct values it takes
+type AttributeStats struct {
+	Name        string `json:"name"`
+	Entities    int    `json:"entities"`
+	Cardinality int    `json:"cardinality"`
+}
+
+// EntityOffset is the message an entity was last updated by.
+type EntityOffset struct {
+	ID        string `json:"id"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// StateStats summarises what a consumer has materialized:
+// * Consumed and Deleted - messages and tombstones applied
+// * Offsets - the next offset to consume per partition
+// * LastUpdates - per entity, ordered by id
+type StateStats struct {
+	Entities    int                   `json:"entities"`
+	Consumed    int                   `json:"consumed"`
+	Deleted     int                   `json:"deleted"`
+	Offsets     []cfg.PartitionOffset `json:"offsets"`
+	Attributes  []AttributeStats      `json:"attributes"`
+	LastUpdates []EntityOffset        `json:"lastUpdates"`
+}
+
+// Entity returns the materialized state of one entity.
+func (c *ConsumerPlugin) Entity(entityID string) (*Entity, bool) {
+	return c.store.Get(entityID)
+}
+
+// Entities returns a page of the materialized entities. Pages past the end are empty.
+func (c *ConsumerPlugin) Entities(page, pageSize int) EntityPage {
+	entities := c.sortedEntities()
+	result := EntityPage{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(entities),
+		Entities: []*Entity{},
+	}
+	// compare pages before multiplying, as a large page would overflow its start
+	if len(entities) > 0 && page >= 1 && pageSize >= 1 && page-1 <= (len(entities)-1)/pageSize {
+		start := (page - 1) * pageSize
+		result.Entities = entities[start : start+min(pageSize, len(entities)-start)]
+	}
+	return result
+}
+
+// Stats computes the statistics of the materialized view; it walks every entity.
+func (c *ConsumerPlugin) Stats() StateStats {
+	c.mu.Lock()
+	stats := StateStats{
+		Consumed: c.counter,
+		Deleted:  c.deleteCount,
+	}
+	c.mu.Unlock()
+
+	entities := c.sortedEntities()
+	stats.Entities = len(entities)
+	stats.Offsets = c.store.Offsets()
+	stats.LastUpdates = make([]EntityOffset, 0, len(entities))
+	values := make(map[string]map[string]struct{})
+	attributes := make(map[string]int)
+	for _, entity := range entities {
+		stats.LastUpdates = append(stats.LastUpdates, EntityOffset{
+			ID:        entity.ID,
+			Partition: entity.Partition,
+			Offset:    entity.Offset,
+		})
+		for name, value := range entity.Payload.Attributes {
+			attributes[name]++
+			if values[name] == nil {
+				values[name] = make(map[string]struct{})
+			}
+			// values are compared by their JSON encoding, which tells 1 from "1"
+			encoded, _ := json.Marshal(value)
+			values[name][string(encoded)] = struct{}{}
+		}
+	}
+	stats.Attributes = make([]AttributeStats, 0, len(attributes))
+	for name, count := range attributes {
+		stats.Attributes = append(stats.Attributes, AttributeStats{
+			Name:        name,
+			Entities:    count,
+			Cardinality: len(values[name]),
+		})
+	}
+	sort.Slice(stats.Attributes, func(i, j int) bool {
+		return stats.Attributes[i].Name < stats.Attributes[j].Name
+	})
+	return stats
+}
+
+func (c *ConsumerPlugin) sortedEntities() []*Entity {
+	entities := make([]*Entity, 0, c.store.Len())
+	c.store.Range(func(entity *Entity) bool {
+		entities = append(entities, entity)
+		return true
+	})
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].ID < entities[j].ID
+	})
+	return entities
+}
@@ -0,0 +1,187 @@
+package entityrepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+)
+
+// Payload versions. A v1 payload may omit its version, as producers predating versioning
+// did. v2 changes the attributes of v1:
+// * renames attr-0 to label
+// * removes attr-1
+// * adds status
+const (
+	PayloadV1            = 1
+	PayloadV2            = 2
+	LatestPayloadVersion = PayloadV2
+
+	v2StatusDefault = "unknown"
+)
+
+// ErrIncompatible is returned for payloads that cannot be read at the consumer's version:
+// payloads from a newer producer, or missing fields their version requires.
+var ErrIncompatible = errors.New("incompatible payload")
+
+// upcasters upgrade a payload from the version they are keyed by to the next one.
+var upcasters = map[int]func(payload *Payload) error{
+	PayloadV1: upcastV1ToV2,
+}
+
+// toV2 reshapes a v1 payload as a v2 producer would emit it.
+func toV2(payload *Payload) {
+	payload.Version = PayloadV2
+	if label, ok := payload.Attributes["attr-0"]; ok {
+		payload.Attributes["label"] = label
+		delete(payload.Attributes, "attr-0")
+	}
+	delete(payload.Attributes, "attr-1")
+	payload.Attributes["status"] = "active"
+}
+
+func upcastV1ToV2(payload *Payload) error {
+	label, ok := payload.Attributes["attr-0"]
+	if !ok {
+		return fmt.Errorf("%w: v1 payload of %s has no attr-0", ErrIncompatible, payload.EntityID)
+	}
+	payload.Attributes["label"] = label
+	delete(payload.Attributes, "attr-0")
+	delete(payload.Attributes, "attr-1")
+	payload.Attributes["status"] = v2StatusDefault
+	return nil
+}
+
+// payloadVersion treats a payload without a version as v1.
+func payloadVersion(payload *Payload) int {
+	if payload.Version == 0 {
+		return PayloadV1
+	}
+	return payload.Version
+}
+
+// upcast upgrades payload, one version at a time, to target.
+func upcast(payload *Payload, target int) error {
+	version := payloadVersion(payload)
+	if version < PayloadV1 {
+		return fmt.Errorf("%w: payload of %s has unknown version %d", ErrIncompatible, payload.EntityID, version)
+	}
+	if version > target {
+		return fmt.Errorf("%w: v%d payload of %s is newer than v%d", ErrIncompatible, version, payload.EntityID, target)
+	}
+	if version == PayloadV2 {
+		if _, ok := payload.Attributes["label"]; !ok {
+			return fmt.Errorf("%w: v2 payload of %s has no label", ErrIncompatible, payload.EntityID)
+		}
+	}
+	for ; version < target; version++ {
+		if err := upcasters[version](payload); err != nil {
+			return err
+		}
+	}
+	payload.Version = target
+	return nil
+}
+
+// SchemaReport counts the payload versions a consumer handled, once per message however
+// often it is retried:
+// * Versions - payloads received per version, before upcasting
+// * Upcast - payloads upgraded to the consumer's version
+// * Incompatible - payloads rejected as newer than, or invalid at, their version
+type SchemaReport struct {
+	ConsumerVersion int            `json:"consumerVersion"`
+	Versions        []VersionCount `json:"versions"`
+	Upcast          int64          `json:"upcast"`
+	Incompatible    int64          `json:"incompatible"`
+}
+
+type VersionCount struct {
+	Version  int   `json:"version"`
+	Messages int64 `json:"messages"`
+}
+
+// schemaDecoder decodes payloads at the consumer's version and counts what it sees. It
+// is safe for concurrent use, as it runs before the ConsumerPlugin takes its lock.
+type schemaDecoder struct {
+	target       int
+	mu           sync.Mutex
+	versions     map[int]int64
+	upcast       int64
+	incompatible int64
+}
+
+func newSchemaDecoder(target int) (*schemaDecoder, error) {
+	if target == 0 {
+		target = LatestPayloadVersion
+	}
+	if target < PayloadV1 || target > LatestPayloadVersion {
+		return nil, fmt.Errorf("unknown payload schema version %d", target)
+	}
+	return &schemaDecoder{target: target, versions: make(map[int]int64)}, nil
+}
+
+// decode unmarshals and upcasts the payload of msg, and returns the version it was
+// produced at, or 0 if it is not a payload at all. Compatibility failures wrap
+// ErrIncompatible.
+func (d *schemaDecoder) decode(msg *k.Message) (*Payload, int, error) {
+	var payload Payload
+	if err := json.Unmarshal(msg.Value, &payload); err != nil {
+		return nil, 0, err
+	}
+	if payload.Attributes == nil {
+		payload.Attributes = make(map[string]interface{})
+	}
+	version := payloadVersion(&payload)
+	if err := upcast(&payload, d.target); err != nil {
+		return nil, version, err
+	}
+	return &payload, version, nil
+}
+
+// count records the outcome of decoding msg once per message: retried messages were
+// counted on their first attempt, and the caller counts a redelivered batch only once it
+// is handled.
+func (d *schemaDecoder) count(msg *k.Message, version int, err error) {
+	if version == 0 || isRetry(msg) {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.versions[version]++
+	if err != nil {
+		d.incompatible++
+	} else if version < d.target {
+		d.upcast++
+	}
+}
+
+func isRetry(msg *k.Message) bool {
+	for _, header := range msg.Headers {
+		if header.Key == infra.HeaderAttempt {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *schemaDecoder) report() SchemaReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := SchemaReport{
+		ConsumerVersion: d.target,
+		Versions:        make([]VersionCount, 0, len(d.versions)),
+		Upcast:          d.upcast,
+		Incompatible:    d.incompatible,
+	}
+	for version, messages := range d.versions {
+		report.Versions = append(report.Versions, VersionCount{Version: version, Messages: messages})
+	}
+	sort.Slice(report.Versions, func(i, j int) bool {
+		return report.Versions[i].Version < report.Versions[j].Version
+	})
+	return report
+}
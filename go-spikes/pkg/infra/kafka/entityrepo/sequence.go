@@ -0,0 +1,220 @@
+package entityrepo
+
+import (
+	"sort"
+	"strconv"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+const (
+	// HeaderProducerRun and HeaderSequence repeat the payload's sequence fields, so that
+	// tombstones, which have no payload, can be verified too.
+	HeaderProducerRun = "x-producer-run"
+	HeaderSequence    = "x-sequence"
+
+	SequenceGap       = "gap"
+	SequenceDuplicate = "duplicate"
+	SequenceReordered = "reordered"
+
+	// maxSequenceSamples bounds the anomalies listed in a SequenceReport
+	maxSequenceSamples = 100
+)
+
+// sequenceTracker follows the sequence numbers seen for one key. Sequences skipped over
+// are kept in missing until they arrive late.
+type sequenceTracker struct {
+	last    int64
+	missing map[int64]struct{}
+}
+
+// observe records the sequence and classifies it as in order (""), a gap, a duplicate
+// or a late, reordered delivery.
+func (t *sequenceTracker) observe(sequence int64) string {
+	switch {
+	case sequence == t.last+1:
+		t.last = sequence
+		return ""
+	case sequence > t.last+1:
+		if t.missing == nil {
+			t.missing = make(map[int64]struct{})
+		}
+		for s := t.last + 1; s < sequence; s++ {
+			t.missing[s] = struct{}{}
+		}
+		t.last = sequence
+		return SequenceGap
+	default:
+		if _, ok := t.missing[sequence]; ok {
+			delete(t.missing, sequence)
+			return SequenceReordered
+		}
+		return SequenceDuplicate
+	}
+}
+
+func (t *sequenceTracker) has(sequence int64) bool {
+	if sequence < 1 || sequence > t.last {
+		return false
+	}
+	_, missing := t.missing[sequence]
+	return !missing
+}
+
+// SequenceAnomaly is a sample of an out-of-sequence delivery for a key.
+type SequenceAnomaly struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Sequence int64  `json:"sequence"`
+	Expected int64  `json:"expected"`
+}
+
+// SequenceReport summarises the per-entity, per-producer-run sequences a consumer saw:
+// * Gaps - sequences skipped over and never delivered later
+// * Duplicates - sequences delivered more than once
+// * Reordered - sequences delivered after a later one
+// * Unsequenced - messages without a producer run id or sequence
+// When cross-checked with the producer's delivery acks:
+// * Lost - acknowledged sequences the consumer never received
+// * Unacknowledged - received sequences the producer never saw an ack for
+type SequenceReport struct {
+	Clean          bool              `json:"clean"`
+	Keys           int               `json:"keys"`
+	Received       int64             `json:"received"`
+	Gaps           int64             `json:"gaps"`
+	Duplicates     int64             `json:"duplicates"`
+	Reordered      int64             `json:"reordered"`
+	Unsequenced    int64             `json:"unsequenced"`
+	CrossChecked   bool              `json:"crossChecked"`
+	Acked          int64             `json:"acked,omitempty"`
+	Lost           int64             `json:"lost,omitempty"`
+	Unacknowledged int64             `json:"unacknowledged,omitempty"`
+	Samples        []SequenceAnomaly `json:"samples,omitempty"`
+}
+
+// SequenceVerifier finds gaps, duplicates and reordering per key as messages are
+// consumed. It is not safe for concurrent use; the ConsumerPlugin guards it.
+type SequenceVerifier struct {
+	keys        map[string]*sequenceTracker
+	received    int64
+	duplicates  int64
+	reordered   int64
+	unsequenced int64
+	samples     []SequenceAnomaly
+}
+
+func NewSequenceVerifier() *SequenceVerifier {
+	return &SequenceVerifier{keys: make(map[string]*sequenceTracker)}
+}
+
+func (v *SequenceVerifier) Observe(runID, entityID string, sequence int64) {
+	if runID == "" || sequence <= 0 {
+		v.unsequenced++
+		return
+	}
+	v.received++
+	key := sequenceKey(runID, entityID)
+	tracker, ok := v.keys[key]
+	if !ok {
+		tracker = &sequenceTracker{}
+		v.keys[key] = tracker
+	}
+	expected := tracker.last + 1
+	anomaly := tracker.observe(sequence)
+	switch anomaly {
+	case "":
+		return
+	case SequenceDuplicate:
+		v.duplicates++
+	case SequenceReordered:
+		v.reordered++
+	}
+	if len(v.samples) < maxSequenceSamples {
+		v.samples = append(v.samples, SequenceAnomaly{
+			Key:      key,
+			Type:     anomaly,
+			Sequence: sequence,
+			Expected: expected,
+		})
+	}
+}
+
+// Report summarises the sequences observed so far.
+func (v *SequenceVerifier) Report() SequenceReport {
+	return v.report(nil)
+}
+
+// report is Report, cross-checked against the producer's acks when they are given.
+func (v *SequenceVerifier) report(acks map[string]*sequenceTracker) SequenceReport {
+	report := SequenceReport{
+		Keys:         len(v.keys),
+		Received:     v.received,
+		Duplicates:   v.duplicates,
+		Reordered:    v.reordered,
+		Unsequenced:  v.unsequenced,
+		CrossChecked: acks != nil,
+		Samples:      append([]SequenceAnomaly(nil), v.samples...),
+	}
+	for _, tracker := range v.keys {
+		report.Gaps += int64(len(tracker.missing))
+	}
+
+	if acks != nil {
+		keys := make(map[string]struct{}, len(acks)+len(v.keys))
+		for key := range acks {
+			keys[key] = struct{}{}
+		}
+		for key := range v.keys {
+			keys[key] = struct{}{}
+		}
+		for key := range keys {
+			acked, received := acks[key], v.keys[key]
+			if acked == nil {
+				acked = &sequenceTracker{}
+			}
+			if received == nil {
+				received = &sequenceTracker{}
+			}
+			for s := int64(1); s <= max(acked.last, received.last); s++ {
+				wasAcked, wasReceived := acked.has(s), received.has(s)
+				if wasAcked {
+					report.Acked++
+				}
+				if wasAcked && !wasReceived {
+					report.Lost++
+				} else if wasReceived && !wasAcked {
+					report.Unacknowledged++
+				}
+			}
+		}
+	}
+
+	report.Clean = report.Gaps == 0 && report.Duplicates == 0 && report.Reordered == 0 && report.Lost == 0
+	sort.Slice(report.Samples, func(i, j int) bool {
+		return report.Samples[i].Key < report.Samples[j].Key
+	})
+	return report
+}
+
+func sequenceKey(runID, entityID string) string {
+	return runID + "/" + entityID
+}
+
+// messageSequence returns the producer run id and sequence of a consumed message,
+// from the payload or, for tombstones, from the headers.
+func messageSequence(msg *k.Message, payload *Payload) (string, int64) {
+	if payload != nil && payload.ProducerRunID != "" {
+		return payload.ProducerRunID, payload.Sequence
+	}
+	var runID string
+	var sequence int64
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case HeaderProducerRun:
+			runID = string(header.Value)
+		case HeaderSequence:
+			sequence, _ = strconv.ParseInt(string(header.Value), 10, 64)
+		}
+	}
+	return runID, sequence
+}
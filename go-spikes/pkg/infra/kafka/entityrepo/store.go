@@ -0,0 +1,198 @@
+package entityrepo
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+)
+
+// Entity is the materialized state of an entity and the message it was last updated by.
+type Entity struct {
+	ID        string    `json:"id"`
+	Payload   *Payload  `json:"payload"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// StateStore holds a consumer's materialized view of the entities, along with the next
+// offset to consume per topic partition once everything before it has been applied.
+// Implementations are safe for concurrent use.
+type StateStore interface {
+	Get(entityID string) (*Entity, bool)
+	Put(entity *Entity) error
+	Delete(entityID string) error
+	Len() int
+	// Range calls fn for every entity, in no particular order, until fn returns false
+	Range(fn func(entity *Entity) bool)
+	// MarkOffset records that every message of the topic partition before next has been applied
+	MarkOffset(topic string, partition int32, next int64) error
+	// Offsets returns the next offset to consume per topic partition
+	Offsets() []cfg.PartitionOffset
+	// Snapshot persists the state and offsets together, if the store is durable
+	Snapshot() error
+	Close() error
+}
+
+func NewStateStore(storeCfg cfg.StateStoreConfig) (StateStore, error) {
+	switch storeCfg.Type {
+	case "", cfg.StateStoreMemory:
+		return NewMemoryStore(storeCfg.MaxEntries, storeCfg.TTL), nil
+	case cfg.StateStoreDisk:
+		return NewDiskStore(storeCfg.Path, storeCfg.SnapshotInterval)
+	default:
+		return nil, fmt.Errorf("unknown state store type %q", storeCfg.Type)
+	}
+}
+
+// memoryStore is an in-memory store that evicts the least recently updated entity beyond
+// maxEntries and expires entities not updated within ttl. Reads do not count as use, so
+// that inspecting the view does not change what it keeps.
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	entries    map[string]*list.Element
+	// lru holds *Entity values, the most recently updated at the front
+	lru     *list.List
+	offsets offsetMap
+}
+
+func NewMemoryStore(maxEntries int, ttl time.Duration) StateStore {
+	return &memoryStore{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		offsets:    make(offsetMap),
+	}
+}
+
+func (m *memoryStore) Get(entityID string) (*Entity, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	element, ok := m.entries[entityID]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*Entity), true
+}
+
+func (m *memoryStore) Put(entity *Entity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.entries[entity.ID]; ok {
+		element.Value = entity
+		m.lru.MoveToFront(element)
+	} else {
+		m.entries[entity.ID] = m.lru.PushFront(entity)
+	}
+	m.expire()
+	for m.maxEntries > 0 && m.lru.Len() > m.maxEntries {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+func (m *memoryStore) Delete(entityID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.entries[entityID]; ok {
+		m.remove(element)
+	}
+	return nil
+}
+
+func (m *memoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	return m.lru.Len()
+}
+
+func (m *memoryStore) Range(fn func(entity *Entity) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	for element := m.lru.Front(); element != nil; element = element.Next() {
+		if !fn(element.Value.(*Entity)) {
+			return
+		}
+	}
+}
+
+func (m *memoryStore) MarkOffset(topic string, partition int32, next int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offsets.mark(topic, partition, next)
+	return nil
+}
+
+func (m *memoryStore) Offsets() []cfg.PartitionOffset {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.offsets.list()
+}
+
+func (m *memoryStore) Snapshot() error {
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// expire drops the entities not updated within ttl, oldest first.
+func (m *memoryStore) expire() {
+	if m.ttl <= 0 {
+		return
+	}
+	for element := m.lru.Back(); element != nil; element = m.lru.Back() {
+		if time.Since(element.Value.(*Entity).UpdatedAt) <= m.ttl {
+			return
+		}
+		m.remove(element)
+	}
+}
+
+func (m *memoryStore) remove(element *list.Element) {
+	m.lru.Remove(element)
+	delete(m.entries, element.Value.(*Entity).ID)
+}
+
+// topicPartition keys the stored offsets; an empty topic is a partition stored before
+// offsets were kept per topic.
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// offsetMap holds the next offset to consume per topic partition.
+type offsetMap map[topicPartition]int64
+
+// mark never moves an offset back, e.g. when a seek replays messages already applied.
+func (o offsetMap) mark(topic string, partition int32, next int64) {
+	key := topicPartition{topic: topic, partition: partition}
+	if current, ok := o[key]; !ok || next > current {
+		o[key] = next
+	}
+}
+
+func (o offsetMap) list() []cfg.PartitionOffset {
+	offsets := make([]cfg.PartitionOffset, 0, len(o))
+	for key, offset := range o {
+		offsets = append(offsets, cfg.PartitionOffset{Topic: key.topic, Partition: key.partition, Offset: offset})
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		if offsets[i].Topic != offsets[j].Topic {
+			return offsets[i].Topic < offsets[j].Topic
+		}
+		return offsets[i].Partition < offsets[j].Partition
+	})
+	return offsets
+}
@@ -0,0 +1,205 @@
+package entityrepo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultSnapshotInterval = 10 * time.Second
+	diskStoreOpenTimeout    = time.Second
+)
+
+var (
+	entitiesBucket = []byte("entities")
+	offsetsBucket  = []byte("offsets")
+)
+
+// diskStore serves the view from memory and writes it to a bbolt file every snapshot
+// interval. Entities and offsets are written in the same transaction, so a restarted
+// consumer that restores the file and resumes from its offsets replays only messages
+// applied after the last snapshot.
+type diskStore struct {
+	mu       sync.Mutex
+	db       *bolt.DB
+	interval time.Duration
+	entities map[string]*Entity
+	// dirty and deleted are the changes since the last snapshot
+	dirty        map[string]struct{}
+	deleted      map[string]struct{}
+	offsets      offsetMap
+	lastSnapshot time.Time
+}
+
+// NewDiskStore opens, or creates, the store at path and restores its entities and offsets.
+func NewDiskStore(path string, snapshotInterval time.Duration) (StateStore, error) {
+	if path == "" {
+		return nil, errors.New("disk state store needs a path")
+	}
+	if snapshotInterval <= 0 {
+		snapshotInterval = defaultSnapshotInterval
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: diskStoreOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s: %w", path, err)
+	}
+	store := &diskStore{
+		db:           db,
+		interval:     snapshotInterval,
+		entities:     make(map[string]*Entity),
+		dirty:        make(map[string]struct{}),
+		deleted:      make(map[string]struct{}),
+		offsets:      make(offsetMap),
+		lastSnapshot: time.Now(),
+	}
+	if err = store.restore(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to restore state store %s: %w", path, err)
+	}
+	return store, nil
+}
+
+func (d *diskStore) restore() error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		entities, err := tx.CreateBucketIfNotExists(entitiesBucket)
+		if err != nil {
+			return err
+		}
+		offsets, err := tx.CreateBucketIfNotExists(offsetsBucket)
+		if err != nil {
+			return err
+		}
+		err = entities.ForEach(func(key, value []byte) error {
+			var entity Entity
+			if err := json.Unmarshal(value, &entity); err != nil {
+				return fmt.Errorf("entity %s: %w", key, err)
+			}
+			d.entities[string(key)] = &entity
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return offsets.ForEach(func(key, value []byte) error {
+			// the key is the partition followed by the topic, which older files lack
+			d.offsets.mark(string(key[4:]), int32(binary.BigEndian.Uint32(key)), int64(binary.BigEndian.Uint64(value)))
+			return nil
+		})
+	})
+}
+
+func (d *diskStore) Get(entityID string) (*Entity, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entity, ok := d.entities[entityID]
+	return entity, ok
+}
+
+func (d *diskStore) Put(entity *Entity) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entities[entity.ID] = entity
+	d.dirty[entity.ID] = struct{}{}
+	delete(d.deleted, entity.ID)
+	return nil
+}
+
+func (d *diskStore) Delete(entityID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entities, entityID)
+	delete(d.dirty, entityID)
+	d.deleted[entityID] = struct{}{}
+	return nil
+}
+
+func (d *diskStore) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entities)
+}
+
+func (d *diskStore) Range(fn func(entity *Entity) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entity := range d.entities {
+		if !fn(entity) {
+			return
+		}
+	}
+}
+
+// MarkOffset also takes the periodic snapshot, as the messages before next have then
+// been fully applied. A failed snapshot keeps its changes, which the next one retries.
+func (d *diskStore) MarkOffset(topic string, partition int32, next int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.offsets.mark(topic, partition, next)
+	if time.Since(d.lastSnapshot) < d.interval {
+		return nil
+	}
+	return d.snapshot()
+}
+
+func (d *diskStore) Offsets() []cfg.PartitionOffset {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.offsets.list()
+}
+
+func (d *diskStore) Snapshot() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.snapshot()
+}
+
+// snapshot writes the changes since the last snapshot; the caller holds mu.
+func (d *diskStore) snapshot() error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		entities := tx.Bucket(entitiesBucket)
+		for entityID := range d.deleted {
+			if err := entities.Delete([]byte(entityID)); err != nil {
+				return err
+			}
+		}
+		for entityID := range d.dirty {
+			value, err := json.Marshal(d.entities[entityID])
+			if err != nil {
+				return err
+			}
+			if err = entities.Put([]byte(entityID), value); err != nil {
+				return err
+			}
+		}
+		offsets := tx.Bucket(offsetsBucket)
+		for topicPartition, offset := range d.offsets {
+			key := append(binary.BigEndian.AppendUint32(nil, uint32(topicPartition.partition)), topicPartition.topic...)
+			if err := offsets.Put(key, binary.BigEndian.AppendUint64(nil, uint64(offset))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	d.lastSnapshot = time.Now()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot state store: %w", err)
+	}
+	clear(d.dirty)
+	clear(d.deleted)
+	return nil
+}
+
+// Close takes a final snapshot and closes the file.
+func (d *diskStore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.snapshot()
+	return errors.Join(err, d.db.Close())
+}
@@ -0,0 +1,107 @@
+package entityrepo
+
+import (
+	"sort"
+)
+
+// StaleEntity is an entity the consumer holds at an older, or different, state than the
+// last one the producer had acknowledged.
+type StaleEntity struct {
+	ID               string `json:"id"`
+	ProducedRunID    string `json:"producedRunId"`
+	ProducedSequence int64  `json:"producedSequence"`
+	ConsumedRunID    string `json:"consumedRunId"`
+	ConsumedSequence int64  `json:"consumedSequence"`
+}
+
+// StateCheck compares the last state the producer had acknowledged for every entity with
+// the consumer's materialized view at the end of a run:
+// * Matching - entities the consumer holds at the last acknowledged state
+// * Stale - entities the consumer holds at an earlier state
+// * Missing - live on the producer side, absent from the consumer
+// * Resurrected - deleted on the producer side, still present in the consumer
+// * Extra - present in the consumer but never acknowledged by the producer
+// Matches is the pass/fail answer: every entity converged. Skipped gives the reason the
+// view could not be compared, e.g. a store restored from an earlier run or one that evicts
+// entities, in which case the counts are empty and Matches is false.
+type StateCheck struct {
+	Matches          bool          `json:"matches"`
+	Skipped          string        `json:"skipped,omitempty"`
+	ProducedLive     int           `json:"producedLive"`
+	ProducedDeleted  int           `json:"producedDeleted"`
+	ConsumedEntities int           `json:"consumedEntities"`
+	Matching         int           `json:"matching"`
+	Stale            []StaleEntity `json:"stale,omitempty"`
+	Missing          []string      `json:"missing,omitempty"`
+	Resurrected      []string      `json:"resurrected,omitempty"`
+	Extra            []string      `json:"extra,omitempty"`
+}
+
+// VerifyMaterializedState must only be called once both jobs have finished running. The
+// check is also part of the consumer's result.
+func VerifyMaterializedState(producer *ProducerPlugin, consumer *ConsumerPlugin) StateCheck {
+	consumer.mu.Lock()
+	defer consumer.mu.Unlock()
+	producer.mu.Lock()
+	defer producer.mu.Unlock()
+
+	check := compareState(producer, consumer)
+	consumer.stateCheck = &check
+	return check
+}
+
+// compareState compares the views; the caller holds the mu of both plugins.
+func compareState(producer *ProducerPlugin, consumer *ConsumerPlugin) StateCheck {
+	var check StateCheck
+	storeCfg := consumer.pluginCfg.StateStore
+	switch {
+	case consumer.restored:
+		check.Skipped = "the state store was restored with entities of an earlier run"
+		return check
+	case storeCfg.MaxEntries > 0 || storeCfg.TTL > 0:
+		check.Skipped = "the state store evicts entities"
+		return check
+	}
+	for entityID, produced := range producer.lastAcked {
+		consumed, ok := consumer.store.Get(entityID)
+		switch {
+		case produced.Deleted:
+			check.ProducedDeleted++
+			if ok {
+				check.Resurrected = append(check.Resurrected, entityID)
+			}
+		case !ok:
+			check.ProducedLive++
+			check.Missing = append(check.Missing, entityID)
+		case consumed.Payload.ProducerRunID != produced.ProducerRunID || consumed.Payload.Sequence != produced.Sequence:
+			check.ProducedLive++
+			check.Stale = append(check.Stale, StaleEntity{
+				ID:               entityID,
+				ProducedRunID:    produced.ProducerRunID,
+				ProducedSequence: produced.Sequence,
+				ConsumedRunID:    consumed.Payload.ProducerRunID,
+				ConsumedSequence: consumed.Payload.Sequence,
+			})
+		default:
+			check.ProducedLive++
+			check.Matching++
+		}
+	}
+	consumer.store.Range(func(entity *Entity) bool {
+		if _, produced := producer.lastAcked[entity.ID]; !produced {
+			check.Extra = append(check.Extra, entity.ID)
+		}
+		return true
+	})
+	check.ConsumedEntities = consumer.store.Len()
+	check.Matches = len(check.Stale) == 0 && len(check.Missing) == 0 &&
+		len(check.Resurrected) == 0 && len(check.Extra) == 0
+
+	sort.Slice(check.Stale, func(i, j int) bool {
+		return check.Stale[i].ID < check.Stale[j].ID
+	})
+	sort.Strings(check.Missing)
+	sort.Strings(check.Resurrected)
+	sort.Strings(check.Extra)
+	return check
+}
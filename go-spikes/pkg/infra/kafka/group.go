@@ -0,0 +1,445 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+const (
+	ScaleTriggerInitial  = "initial"
+	ScaleTriggerSchedule = "schedule"
+	ScaleTriggerAPI      = "api"
+
+	defaultStabilizeTimeout = 2 * time.Minute
+	stabilizePollInterval   = 100 * time.Millisecond
+	// stableChecks is the number of consecutive polls the assignment must stay complete,
+	// as a revoked partition can still be listed right after its callback
+	stableChecks = 3
+	// baselineWindow is how far back the throughput before a change is measured
+	baselineWindow  = 10 * time.Second
+	maxRateSamples  = 600
+	metadataTimeout = 5 * time.Second
+)
+
+// GroupScaler is implemented by jobs whose number of consumer group members can be
+// changed while running.
+type GroupScaler interface {
+	ScaleTo(ctx context.Context, members int) (GroupScaleEvent, error)
+}
+
+// GroupScaleEvent describes one change to the number of members and how the group
+// settled afterwards:
+// * Stable - whether every partition ended up assigned to exactly one member in time
+// * RebalanceSeconds - the time from the change until the group was stable
+// * Spread - the number of partitions of each member once stable
+// * ThroughputLost - the messages the group fell behind its BaselineRate while rebalancing
+type GroupScaleEvent struct {
+	Time                    time.Time      `json:"time"`
+	Trigger                 string         `json:"trigger"`
+	From                    int            `json:"from"`
+	To                      int            `json:"to"`
+	Stable                  bool           `json:"stable"`
+	RebalanceSeconds        float64        `json:"rebalanceSeconds"`
+	Spread                  map[string]int `json:"spread"`
+	BaselineRate            float64        `json:"baselineRate"`
+	ConsumedDuringRebalance int64          `json:"consumedDuringRebalance"`
+	ThroughputLost          float64        `json:"throughputLost"`
+}
+
+type GroupScaleResult struct {
+	ConsumerGroup    string            `json:"consumerGroup"`
+	StaticMembership bool              `json:"staticMembership"`
+	Members          []string          `json:"members"`
+	MessagesConsumed int64             `json:"messagesConsumed"`
+	Events           []GroupScaleEvent `json:"events"`
+}
+
+// NewConsumerGroupJob creates a job that runs scale.Members consumers of plugin in the
+// consumer group of kc, and changes their number on schedule or through ScaleTo.
+// jobPlugin names and times the job itself. Members do not sample lag, as they would
+// overwrite each other's KafkaPartitionLag series. Members have no retry tiers or DLQ,
+// so a dead letter config is refused rather than dropping rejected messages.
+func NewConsumerGroupJob[T any](kc cfg.KafkaConfig, scale cfg.GroupScaleConfig, jobPlugin model.Plugin, plugin ConsumerPlugin[T]) (model.Job, error) {
+	if scale.Members < 1 {
+		return nil, errors.New("a consumer group job needs at least one member")
+	}
+	if kc.ConsumerConfig.DeadLetter.Enabled {
+		return nil, errors.New("a consumer group job does not support consumer.deadLetter")
+	}
+	for _, step := range scale.Steps {
+		if step.Members < 0 {
+			return nil, fmt.Errorf("invalid member count %d in scale step", step.Members)
+		}
+	}
+	if scale.StabilizeTimeout <= 0 {
+		scale.StabilizeTimeout = defaultStabilizeTimeout
+	}
+	kc.ConsumerConfig.LagInterval = 0
+	return &consumerGroupJobImpl[T]{
+		config:    kc,
+		scale:     scale,
+		jobPlugin: jobPlugin,
+		plugin:    plugin,
+	}, nil
+}
+
+type consumerGroupJobImpl[T any] struct {
+	config    cfg.KafkaConfig
+	scale     cfg.GroupScaleConfig
+	jobPlugin model.Plugin
+	plugin    ConsumerPlugin[T]
+
+	// scaleMu serializes scaling from the schedule and the API
+	scaleMu sync.Mutex
+	// mu guards the state below
+	mu sync.Mutex
+	// runCtx is the context of Run, nil until Run has started
+	runCtx          context.Context
+	members         []*groupMember[T]
+	removedConsumed int64
+	events          []GroupScaleEvent
+	rates           []rateSample
+}
+
+type groupMember[T any] struct {
+	name   string
+	job    *consumerJobImpl[T]
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type rateSample struct {
+	time     time.Time
+	consumed int64
+}
+
+func (g *consumerGroupJobImpl[T]) GetPlugin() model.Plugin {
+	return g.jobPlugin
+}
+
+func (g *consumerGroupJobImpl[T]) Close() {
+	g.scaleMu.Lock()
+	defer g.scaleMu.Unlock()
+	for len(g.members) > 0 {
+		g.removeMember()
+	}
+}
+
+func (g *consumerGroupJobImpl[T]) Run(ctx context.Context) {
+	log := logger.Ctx(ctx)
+	g.mu.Lock()
+	g.runCtx = ctx
+	g.mu.Unlock()
+	log.Info().
+		Str("group", g.config.ConsumerConfig.ConsumerGroup).
+		Int("members", g.scale.Members).
+		Bool("staticMembership", g.scale.StaticMembership).
+		Msg("Starting consumer group job")
+
+	go g.sampleThroughput(ctx)
+	if _, err := g.scaleTo(ctx, g.scale.Members, ScaleTriggerInitial); err != nil {
+		log.Error().Err(err).Msg("Failed to start consumer group members")
+	}
+
+	steps := append([]cfg.GroupScaleStep(nil), g.scale.Steps...)
+	sort.Slice(steps, func(i, j int) bool { return steps[i].After < steps[j].After })
+	start := time.Now()
+schedule:
+	for _, step := range steps {
+		select {
+		case <-ctx.Done():
+			break schedule
+		case <-time.After(time.Until(start.Add(step.After))):
+		}
+		if _, err := g.scaleTo(ctx, step.Members, ScaleTriggerSchedule); err != nil {
+			log.Error().Err(err).Int("members", step.Members).Msg("Failed to scale consumer group")
+		}
+	}
+
+	<-ctx.Done()
+	g.Close()
+	log.Info().Int64("consumed", g.consumedTotal()).Msg("consumer group job done")
+}
+
+func (g *consumerGroupJobImpl[T]) ScaleTo(ctx context.Context, members int) (GroupScaleEvent, error) {
+	if members < 0 {
+		return GroupScaleEvent{}, fmt.Errorf("invalid member count %d", members)
+	}
+	if runCtx := g.running(); runCtx == nil || runCtx.Err() != nil {
+		return GroupScaleEvent{}, errors.New("consumer group job is not running")
+	}
+	return g.scaleTo(ctx, members, ScaleTriggerAPI)
+}
+
+// running returns the context of Run, or nil before Run has started.
+func (g *consumerGroupJobImpl[T]) running() context.Context {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.runCtx
+}
+
+// scaleTo adds or removes the most recently added members, then waits for the group
+// to settle and records how long that took and what throughput was lost meanwhile.
+func (g *consumerGroupJobImpl[T]) scaleTo(ctx context.Context, members int, trigger string) (GroupScaleEvent, error) {
+	g.scaleMu.Lock()
+	defer g.scaleMu.Unlock()
+
+	event := GroupScaleEvent{
+		Time:         time.Now(),
+		Trigger:      trigger,
+		From:         len(g.members),
+		To:           members,
+		BaselineRate: g.recentRate(baselineWindow),
+	}
+	consumedBefore := g.consumedTotal()
+
+	for len(g.members) < members {
+		if err := g.addMember(); err != nil {
+			return event, err
+		}
+	}
+	for len(g.members) > members {
+		g.removeMember()
+	}
+
+	event.Stable = event.From == event.To
+	if !event.Stable {
+		event.Stable, event.Spread = g.awaitStable(ctx, event.Time, event.From < event.To)
+	}
+	elapsed := time.Since(event.Time).Seconds()
+	event.RebalanceSeconds = elapsed
+	event.ConsumedDuringRebalance = g.consumedTotal() - consumedBefore
+	event.ThroughputLost = max(0, event.BaselineRate*elapsed-float64(event.ConsumedDuringRebalance))
+
+	g.mu.Lock()
+	g.events = append(g.events, event)
+	g.mu.Unlock()
+
+	logger.Ctx(ctx).Info().
+		Str("group", g.config.ConsumerConfig.ConsumerGroup).
+		Str("trigger", trigger).
+		Int("from", event.From).
+		Int("to", event.To).
+		Bool("stable", event.Stable).
+		Dur("rebalance", time.Duration(elapsed*float64(time.Second))).
+		Any("spread", event.Spread).
+		Msg("Consumer group scaled")
+	return event, nil
+}
+
+func (g *consumerGroupJobImpl[T]) addMember() error {
+	name := fmt.Sprintf("member-%d", len(g.members)+1)
+	kc := g.config
+	clientId := kc.ConsumerConfig.ClientId
+	if clientId == "" {
+		clientId = kc.ConsumerConfig.ConsumerGroup
+	}
+	kc.ConsumerConfig.ClientId = clientId + "-" + name
+	if g.scale.StaticMembership {
+		// the instance id follows the member's position, so a re-added member reclaims it
+		kc.ConsumerConfig.GroupInstanceId = kc.ConsumerConfig.ConsumerGroup + "-" + name
+	}
+	job, err := newConsumerJob(kc, g.plugin)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+
+	ctx, cancel := context.WithCancel(g.running())
+	member := &groupMember[T]{name: name, job: job, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(member.done)
+		job.Run(ctx)
+	}()
+
+	g.mu.Lock()
+	g.members = append(g.members, member)
+	g.mu.Unlock()
+	return nil
+}
+
+// removeMember stops the newest member and closes its consumer. A static member does
+// not leave the group on close, so its partitions only move after the session timeout.
+func (g *consumerGroupJobImpl[T]) removeMember() {
+	g.mu.Lock()
+	member := g.members[len(g.members)-1]
+	g.members = g.members[:len(g.members)-1]
+	g.mu.Unlock()
+
+	member.cancel()
+	<-member.done
+	member.job.Close()
+
+	g.mu.Lock()
+	g.removedConsumed += member.job.consumed.Load()
+	g.mu.Unlock()
+}
+
+// awaitStable polls the members' assignments until a rebalance has happened since the
+// change and every subscribed partition is assigned to exactly one member. After adding
+// members, each new member must also have a partition, if there are enough of them.
+func (g *consumerGroupJobImpl[T]) awaitStable(ctx context.Context, since time.Time, added bool) (bool, map[string]int) {
+	g.mu.Lock()
+	members := append([]*groupMember[T](nil), g.members...)
+	g.mu.Unlock()
+	spread := make(map[string]int)
+	if len(members) == 0 {
+		return true, spread
+	}
+
+	timeout := time.After(g.scale.StabilizeTimeout)
+	ticker := time.NewTicker(stabilizePollInterval)
+	defer ticker.Stop()
+	checks := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return false, spread
+		case <-timeout:
+			return false, spread
+		case <-ticker.C:
+		}
+
+		partitions, err := g.partitionCount(members[0].job)
+		if err != nil {
+			logger.Ctx(ctx).Warn().Err(err).Msg("Failed to count subscribed partitions")
+			continue
+		}
+		spread = make(map[string]int, len(members))
+		assigned := make(map[string]int)
+		rebalanced := false
+		for _, member := range members {
+			assignment, err := member.job.consumer.Assignment()
+			if err != nil {
+				continue
+			}
+			spread[member.name] = len(assignment)
+			for _, partition := range assignment {
+				assigned[partitionLabel(partition)]++
+			}
+			rebalanced = rebalanced || member.job.rebalancedSince(since)
+		}
+
+		complete := rebalanced && len(assigned) == partitions
+		for _, count := range assigned {
+			complete = complete && count == 1
+		}
+		if added && partitions >= len(members) {
+			for _, member := range members {
+				complete = complete && spread[member.name] > 0
+			}
+		}
+		if !complete {
+			checks = 0
+			continue
+		}
+		if checks++; checks >= stableChecks {
+			return true, spread
+		}
+	}
+}
+
+// partitionCount counts the partitions of the topics the members subscribe to.
+func (g *consumerGroupJobImpl[T]) partitionCount(job *consumerJobImpl[T]) (int, error) {
+	metadata, err := job.consumer.GetMetadata(nil, true, int(metadataTimeout.Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	var patterns []*regexp.Regexp
+	topics := make(map[string]bool)
+	for _, topic := range g.config.SubscriptionTopics() {
+		if !strings.HasPrefix(topic, "^") {
+			topics[topic] = true
+			continue
+		}
+		pattern, err := regexp.Compile(topic)
+		if err != nil {
+			return 0, fmt.Errorf("invalid topic pattern %q: %w", topic, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	count := 0
+	for name, topic := range metadata.Topics {
+		matches := topics[name]
+		for _, pattern := range patterns {
+			matches = matches || pattern.MatchString(name)
+		}
+		if matches {
+			count += len(topic.Partitions)
+		}
+	}
+	return count, nil
+}
+
+func (g *consumerGroupJobImpl[T]) consumedTotal() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	total := g.removedConsumed
+	for _, member := range g.members {
+		total += member.job.consumed.Load()
+	}
+	return total
+}
+
+func (g *consumerGroupJobImpl[T]) sampleThroughput(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			consumed := g.consumedTotal()
+			g.mu.Lock()
+			g.rates = append(g.rates, rateSample{time: now, consumed: consumed})
+			if len(g.rates) > maxRateSamples {
+				g.rates = g.rates[len(g.rates)-maxRateSamples:]
+			}
+			g.mu.Unlock()
+		}
+	}
+}
+
+// recentRate is the messages per second consumed over the last window.
+func (g *consumerGroupJobImpl[T]) recentRate(window time.Duration) float64 {
+	consumed := g.consumedTotal()
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, sample := range g.rates {
+		if now.Sub(sample.time) <= window {
+			if elapsed := now.Sub(sample.time).Seconds(); elapsed > 0 {
+				return float64(consumed-sample.consumed) / elapsed
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func (g *consumerGroupJobImpl[T]) GetResult() interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	result := GroupScaleResult{
+		ConsumerGroup:    g.config.ConsumerConfig.ConsumerGroup,
+		StaticMembership: g.scale.StaticMembership,
+		Members:          make([]string, 0, len(g.members)),
+		MessagesConsumed: g.removedConsumed,
+		Events:           append([]GroupScaleEvent(nil), g.events...),
+	}
+	for _, member := range g.members {
+		result.Members = append(result.Members, member.name)
+		result.MessagesConsumed += member.job.consumed.Load()
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+)
+
+// Error types of the KafkaConsumeErrors metric.
+const (
+	ConsumeErrorBroker      = "broker"
+	ConsumeErrorTimeout     = "timeout"
+	ConsumeErrorDeserialize = "deserialize"
+	ConsumeErrorHandler     = "handler"
+	ConsumeErrorCommit      = "commit"
+)
+
+// ErrDeserialize is wrapped by plugins whose handler fails to decode a message, so the
+// failure is counted as a deserialize rather than a handler error.
+var ErrDeserialize = errors.New("failed to deserialize message")
+
+// classifyPollError tells an empty poll, which is not an error, from a failed one.
+// Errors that are not a kafka.Error are counted as broker errors.
+func classifyPollError(err error) (errorType string, idle bool) {
+	var kafkaErr k.Error
+	if !errors.As(err, &kafkaErr) {
+		return ConsumeErrorBroker, false
+	}
+	if kafkaErr.Code() == k.ErrTimedOut {
+		return "", true
+	}
+	if kafkaErr.IsTimeout() {
+		return ConsumeErrorTimeout, false
+	}
+	return ConsumeErrorBroker, false
+}
+
+func classifyHandlerError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.Is(err, ErrDeserialize) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return ConsumeErrorDeserialize
+	}
+	return ConsumeErrorHandler
+}
+
+func recordConsumeError(topic, errorType string) {
+	metrics.KafkaConsumeErrors.WithLabelValues(topic, errorType).Inc()
+}
+
+// recordConsumed counts a polled message and its size per partition.
+func recordConsumed(message *k.Message) {
+	topic := *message.TopicPartition.Topic
+	partition := strconv.Itoa(int(message.TopicPartition.Partition))
+	metrics.KafkaMessagesConsumed.WithLabelValues(topic, partition).Inc()
+	metrics.KafkaBytesConsumed.WithLabelValues(topic, partition).Add(float64(len(message.Value)))
+	metrics.KafkaMessageSize.WithLabelValues(topic, "consume").Observe(float64(len(message.Value)))
+}
+
+func recordProcessing(topic string, start time.Time) {
+	metrics.KafkaMessageProcessingDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+}
+
+// recordBatchProcessing spreads the handling time of a batch evenly over its messages.
+func recordBatchProcessing(messages []*k.Message, start time.Time) {
+	perMessage := time.Since(start).Seconds() / float64(len(messages))
+	for _, message := range messages {
+		metrics.KafkaMessageProcessingDuration.WithLabelValues(*message.TopicPartition.Topic).Observe(perMessage)
+	}
+}
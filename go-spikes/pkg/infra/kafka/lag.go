@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+)
+
+const (
+	lagQueryTimeout = 5 * time.Second
+	// maxLagSamples bounds the lag time series kept in the job result
+	maxLagSamples = 1000
+)
+
+// LagSample is the consumer lag across the assigned partitions at a point in time.
+type LagSample struct {
+	Time       time.Time        `json:"time"`
+	TotalLag   int64            `json:"totalLag"`
+	MaxLag     int64            `json:"maxLag"`
+	Partitions map[string]int64 `json:"partitions"`
+}
+
+// runLagMonitor samples lag for the assigned partitions every interval until ctx is done,
+// and then removes the series it exported.
+func (c *consumerJobImpl[T]) runLagMonitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reported := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			c.clearLag(reported)
+			return
+		case <-ticker.C:
+			sample, err := c.sampleLag()
+			if err != nil {
+				logger.Ctx(ctx).Warn().Err(err).Msg("Failed to sample consumer lag")
+				continue
+			}
+			c.recordLag(sample, reported)
+		}
+	}
+}
+
+// sampleLag computes lag per assigned partition as the high watermark minus the
+// committed offset. Partitions without a committed offset count from the low watermark.
+func (c *consumerJobImpl[T]) sampleLag() (LagSample, error) {
+	sample := LagSample{
+		Time:       time.Now(),
+		Partitions: make(map[string]int64),
+	}
+	assignment, err := c.consumer.Assignment()
+	if err != nil || len(assignment) == 0 {
+		return sample, err
+	}
+	committed, err := c.consumer.Committed(assignment, int(lagQueryTimeout.Milliseconds()))
+	if err != nil {
+		return sample, err
+	}
+	for _, partition := range committed {
+		low, high, err := c.consumer.QueryWatermarkOffsets(*partition.Topic, partition.Partition, int(lagQueryTimeout.Milliseconds()))
+		if err != nil {
+			return sample, err
+		}
+		offset := int64(partition.Offset)
+		if offset < 0 {
+			offset = low
+		}
+		lag := high - offset
+		if lag < 0 {
+			lag = 0
+		}
+		sample.Partitions[partitionLabel(partition)] = lag
+		sample.TotalLag += lag
+		if lag > sample.MaxLag {
+			sample.MaxLag = lag
+		}
+	}
+	return sample, nil
+}
+
+// recordLag exports the sample on the KafkaPartitionLag gauge, removing series for
+// partitions that are no longer assigned, and appends it to the job result.
+func (c *consumerJobImpl[T]) recordLag(sample LagSample, reported map[string]bool) {
+	group := c.connectionConfig.ConsumerConfig.ConsumerGroup
+	for label := range reported {
+		if _, assigned := sample.Partitions[label]; !assigned {
+			topic, partition := splitPartitionLabel(label)
+			metrics.KafkaPartitionLag.DeleteLabelValues(topic, partition, group)
+			delete(reported, label)
+		}
+	}
+	for label, lag := range sample.Partitions {
+		topic, partition := splitPartitionLabel(label)
+		metrics.KafkaPartitionLag.WithLabelValues(topic, partition, group).Set(float64(lag))
+		reported[label] = true
+	}
+
+	c.resultMu.Lock()
+	defer c.resultMu.Unlock()
+	c.lagSamples = append(c.lagSamples, sample)
+	if len(c.lagSamples) > maxLagSamples {
+		c.lagSamples = c.lagSamples[len(c.lagSamples)-maxLagSamples:]
+	}
+	if sample.MaxLag > c.maxLag {
+		c.maxLag = sample.MaxLag
+	}
+}
+
+// clearLag deletes the KafkaPartitionLag series of a finished job.
+func (c *consumerJobImpl[T]) clearLag(reported map[string]bool) {
+	group := c.connectionConfig.ConsumerConfig.ConsumerGroup
+	for label := range reported {
+		topic, partition := splitPartitionLabel(label)
+		metrics.KafkaPartitionLag.DeleteLabelValues(topic, partition, group)
+		delete(reported, label)
+	}
+}
+
+func partitionLabel(partition k.TopicPartition) string {
+	return *partition.Topic + "/" + strconv.Itoa(int(partition.Partition))
+}
+
+func splitPartitionLabel(label string) (string, string) {
+	for i := len(label) - 1; i >= 0; i-- {
+		if label[i] == '/' {
+			return label[:i], label[i+1:]
+		}
+	}
+	return label, ""
+}
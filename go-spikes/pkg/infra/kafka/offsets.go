@@ -0,0 +1,255 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const offsetQueryTimeout = 10 * time.Second
+
+// Seeker is implemented by jobs whose consumer can be repositioned while running.
+type Seeker interface {
+	Seek(ctx context.Context, position cfg.StartPosition) ([]PartitionOffset, error)
+}
+
+type PartitionOffset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// SeekEvent records a seek of a running job, with the messages consumed up to it so
+// the reprocessing throughput can be derived.
+type SeekEvent struct {
+	Time           time.Time         `json:"time"`
+	Position       cfg.StartPosition `json:"position"`
+	Partitions     []PartitionOffset `json:"partitions"`
+	ConsumedBefore int64             `json:"consumedBefore"`
+}
+
+type seekRequest struct {
+	position cfg.StartPosition
+	response chan seekResponse
+}
+
+type seekResponse struct {
+	partitions []PartitionOffset
+	err        error
+}
+
+// Seek asks the poll loop to reposition every assigned partition and waits for the outcome.
+func (c *consumerJobImpl[T]) Seek(ctx context.Context, position cfg.StartPosition) ([]PartitionOffset, error) {
+	if err := position.Validate(); err != nil {
+		return nil, err
+	}
+	runCtx := c.running()
+	if runCtx == nil {
+		return nil, errors.New("consumer is not running")
+	}
+	request := seekRequest{position: position, response: make(chan seekResponse, 1)}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-runCtx.Done():
+		return nil, errors.New("consumer is not running")
+	case c.seeks <- request:
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case response := <-request.response:
+		return response.partitions, response.err
+	}
+}
+
+// applySeek runs on the poll loop. Messages already handed out are finished first, so
+// their offsets are stored before the partitions are rewound.
+func (c *consumerJobImpl[T]) applySeek(ctx context.Context, request seekRequest) {
+	ctx, span := tracing.StartSpanWithAttributes(
+		ctx,
+		"kafka.consumer.seek",
+		tracing.KafkaAttributes(c.connectionConfig.Topic, "any", "seek"),
+	)
+	defer span.End()
+	tracing.SetSpanAttributes(span, attribute.String("messaging.kafka.seek.position", request.position.Position))
+
+	if c.batch != nil {
+		c.flushBatch(ctx, c.batchPlugin, c.batch.take())
+	}
+	if c.processor != nil {
+		c.processor.drain()
+	}
+
+	partitions, err := c.seekAssigned(request.position)
+	if err != nil {
+		tracing.RecordError(span, err, "Failed to seek")
+		logger.Ctx(ctx).Error().Err(err).Str("position", request.position.Position).Msg("Failed to seek consumer")
+		request.response <- seekResponse{err: err}
+		return
+	}
+
+	c.resultMu.Lock()
+	c.seekEvents = append(c.seekEvents, SeekEvent{
+		Time:           time.Now(),
+		Position:       request.position,
+		Partitions:     partitions,
+		ConsumedBefore: c.consumed.Load(),
+	})
+	c.resultMu.Unlock()
+
+	logger.Ctx(ctx).Info().
+		Str("position", request.position.Position).
+		Str("group", c.connectionConfig.ConsumerConfig.ConsumerGroup).
+		Any("partitions", partitions).
+		Msg("Consumer seeked")
+	request.response <- seekResponse{partitions: partitions}
+}
+
+func (c *consumerJobImpl[T]) seekAssigned(position cfg.StartPosition) ([]PartitionOffset, error) {
+	assignment, err := c.consumer.Assignment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment: %w", err)
+	}
+	if len(assignment) == 0 {
+		return nil, errors.New("consumer has no assigned partitions")
+	}
+	if position.IsCommitted() {
+		if assignment, err = c.consumer.Committed(assignment, int(offsetQueryTimeout.Milliseconds())); err != nil {
+			return nil, fmt.Errorf("failed to get committed offsets: %w", err)
+		}
+		// partitions without a committed offset have nothing to return to
+		committed := assignment[:0]
+		for _, partition := range assignment {
+			if partition.Offset >= 0 {
+				committed = append(committed, partition)
+			}
+		}
+		assignment = committed
+	} else if assignment, err = c.resolveOffsets(position, assignment); err != nil {
+		return nil, err
+	}
+	if len(assignment) == 0 {
+		return nil, errors.New("no assigned partition matches the seek position")
+	}
+
+	if _, err = c.consumer.SeekPartitions(assignment); err != nil {
+		return nil, fmt.Errorf("failed to seek partitions: %w", err)
+	}
+	return toPartitionOffsets(assignment), nil
+}
+
+// resolveOffsets returns the partitions the position applies to, with their offsets set.
+// For the offsets position, partitions without an explicit offset are left out.
+func (c *consumerJobImpl[T]) resolveOffsets(position cfg.StartPosition, partitions []k.TopicPartition) ([]k.TopicPartition, error) {
+	resolved := make([]k.TopicPartition, 0, len(partitions))
+	switch position.Position {
+	case cfg.StartFromEarliest, cfg.StartFromLatest:
+		offset := k.OffsetBeginning
+		if position.Position == cfg.StartFromLatest {
+			offset = k.OffsetEnd
+		}
+		for _, partition := range partitions {
+			partition.Offset = offset
+			resolved = append(resolved, partition)
+		}
+	case cfg.StartFromTimestamp:
+		t, err := position.Time()
+		if err != nil {
+			return nil, err
+		}
+		for _, partition := range partitions {
+			partition.Offset = k.Offset(t.UnixMilli())
+			resolved = append(resolved, partition)
+		}
+		// partitions with no message at or after the timestamp resolve to the end
+		if resolved, err = c.consumer.OffsetsForTimes(resolved, int(offsetQueryTimeout.Milliseconds())); err != nil {
+			return nil, fmt.Errorf("failed to get offsets for %s: %w", position.Timestamp, err)
+		}
+	case cfg.StartFromOffsets:
+		offsets := make(map[string]int64, len(position.Offsets))
+		for _, offset := range position.Offsets {
+			topic := offset.Topic
+			if topic == "" {
+				topic = c.connectionConfig.Topic
+			}
+			offsets[partitionLabel(k.TopicPartition{Topic: &topic, Partition: offset.Partition})] = offset.Offset
+		}
+		for _, partition := range partitions {
+			if offset, ok := offsets[partitionLabel(partition)]; ok {
+				partition.Offset = k.Offset(offset)
+				resolved = append(resolved, partition)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown start position %q", position.Position)
+	}
+	return resolved, nil
+}
+
+// assignFromStartPosition assigns newly assigned partitions at ConsumerConfig.StartFrom,
+// once per partition for the lifetime of the job, so later rebalances resume from the
+// committed offsets. Otherwise the assignment is left to the client.
+func (c *consumerJobImpl[T]) assignFromStartPosition(consumer *k.Consumer, partitions []k.TopicPartition) error {
+	position := c.connectionConfig.ConsumerConfig.StartFrom
+	if position.IsCommitted() {
+		return nil
+	}
+	var unseen []k.TopicPartition
+	for _, partition := range partitions {
+		if !c.started[partitionLabel(partition)] {
+			unseen = append(unseen, partition)
+		}
+	}
+	if len(unseen) == 0 {
+		return nil
+	}
+
+	resolved, err := c.resolveOffsets(position, unseen)
+	if err != nil {
+		return err
+	}
+	offsets := make(map[string]k.Offset, len(resolved))
+	for _, partition := range resolved {
+		offsets[partitionLabel(partition)] = partition.Offset
+	}
+	assignment := make([]k.TopicPartition, 0, len(partitions))
+	for _, partition := range partitions {
+		if offset, ok := offsets[partitionLabel(partition)]; ok {
+			partition.Offset = offset
+		}
+		assignment = append(assignment, partition)
+	}
+
+	if consumer.GetRebalanceProtocol() == "COOPERATIVE" {
+		err = consumer.IncrementalAssign(assignment)
+	} else {
+		err = consumer.Assign(assignment)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign partitions at %s: %w", position.Position, err)
+	}
+	for _, partition := range unseen {
+		c.started[partitionLabel(partition)] = true
+	}
+	return nil
+}
+
+func toPartitionOffsets(partitions []k.TopicPartition) []PartitionOffset {
+	offsets := make([]PartitionOffset, 0, len(partitions))
+	for _, partition := range partitions {
+		offsets = append(offsets, PartitionOffset{
+			Topic:     *partition.Topic,
+			Partition: partition.Partition,
+			Offset:    int64(partition.Offset),
+		})
+	}
+	return offsets
+}
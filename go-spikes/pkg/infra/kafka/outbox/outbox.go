@@ -0,0 +1,154 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/infra/kafka/entityrepo"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Headers of relayed events. The relay also sets the entity-repo run and sequence
+// headers, so that entity-repo consumers can read the topic.
+const (
+	HeaderEventID = "x-outbox-event-id"
+	HeaderRunID   = "x-outbox-run-id"
+)
+
+const (
+	databaseType       = "postgres"
+	defaultEntityTable = "outbox_entities"
+	defaultOutboxTable = "outbox_events"
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Event is a row of the outbox. It is relayed as a message keyed by its entity, whose
+// value is Payload; an event without a Payload deletes its entity and is relayed as a
+// tombstone.
+type Event struct {
+	ID        int64
+	EntityID  string
+	RunID     string
+	Sequence  int64
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// MarshalJSON makes the message value the entity payload written by the writer.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return e.Payload, nil
+}
+
+func (e Event) MessageKey() []byte {
+	return []byte(e.EntityID)
+}
+
+func (e Event) IsTombstone() bool {
+	return e.Payload == nil
+}
+
+func (e Event) MessageHeaders() []k.Header {
+	return []k.Header{
+		{Key: HeaderEventID, Value: []byte(strconv.FormatInt(e.ID, 10))},
+		{Key: HeaderRunID, Value: []byte(e.RunID)},
+		{Key: entityrepo.HeaderProducerRun, Value: []byte(e.RunID)},
+		{Key: entityrepo.HeaderSequence, Value: []byte(strconv.FormatInt(e.Sequence, 10))},
+	}
+}
+
+// messageEvent returns the outbox event id and writer run of a relayed message.
+func messageEvent(msg *k.Message) (int64, string, bool) {
+	var eventID int64
+	var runID string
+	var found bool
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case HeaderEventID:
+			id, err := strconv.ParseInt(string(header.Value), 10, 64)
+			if err != nil {
+				return 0, "", false
+			}
+			eventID, found = id, true
+		case HeaderRunID:
+			runID = string(header.Value)
+		}
+	}
+	return eventID, runID, found
+}
+
+// tables are the entity and outbox tables of the spike.
+type tables struct {
+	entity string
+	outbox string
+}
+
+func newTables(oc cfg.OutboxConfig) (tables, error) {
+	t := tables{entity: oc.EntityTable, outbox: oc.OutboxTable}
+	if t.entity == "" {
+		t.entity = defaultEntityTable
+	}
+	if t.outbox == "" {
+		t.outbox = defaultOutboxTable
+	}
+	for _, name := range []string{t.entity, t.outbox} {
+		if !tableName.MatchString(name) {
+			return tables{}, fmt.Errorf("invalid outbox table name %q", name)
+		}
+	}
+	if t.entity == t.outbox {
+		return tables{}, fmt.Errorf("entity and outbox tables must differ")
+	}
+	return t, nil
+}
+
+// channel is the NOTIFY channel the writer signals new events on.
+func (t tables) channel() string {
+	return t.outbox
+}
+
+// create creates the tables if they are missing. The partial index keeps polling for
+// unpublished events cheap however large the outbox grows.
+func (t tables) create(ctx context.Context, pool *pgxpool.Pool) error {
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	entity_id TEXT PRIMARY KEY,
+	payload JSONB NOT NULL,
+	version BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`, t.entity),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	entity_id TEXT NOT NULL,
+	run_id TEXT NOT NULL,
+	sequence BIGINT NOT NULL,
+	payload JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+	published_at TIMESTAMPTZ
+)`, t.outbox),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_unpublished ON %[1]s (id) WHERE published_at IS NULL", t.outbox),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_run ON %[1]s (run_id)", t.outbox),
+	}
+	for _, statement := range statements {
+		if _, err := pool.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create outbox tables: %w", err)
+		}
+	}
+	return nil
+}
+
+func observe(operation string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DatabaseOperations.WithLabelValues(databaseType, operation, status).Inc()
+	metrics.DatabaseOperationDuration.WithLabelValues(databaseType, operation).Observe(time.Since(start).Seconds())
+}
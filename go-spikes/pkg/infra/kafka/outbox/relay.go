@@ -0,0 +1,376 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/config"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultPollInterval = 100 * time.Millisecond
+	defaultBatchSize    = 500
+	defaultMaxInFlight  = 5000
+)
+
+// RelayStats summarises the relays of a run:
+// * Incarnations and Kills - relays started, and killed to be replaced
+// * Fetched - events read from the outbox, including ones fetched again after a kill
+// * Published - events acknowledged by Kafka and marked as published
+// * MeanLagSeconds and MaxLagSeconds - the time from an event's insert to its publish
+type RelayStats struct {
+	Mode           string  `json:"mode"`
+	Incarnations   int     `json:"incarnations"`
+	Kills          int     `json:"kills"`
+	Fetched        int64   `json:"fetched"`
+	Published      int64   `json:"published"`
+	MeanLagSeconds float64 `json:"meanLagSeconds"`
+	MaxLagSeconds  float64 `json:"maxLagSeconds"`
+}
+
+// Relay moves outbox events to Kafka with the producer job. Each incarnation produces the
+// unpublished events and marks them as published once Kafka acknowledges them. When
+// KillAfter is set, incarnations are killed and replaced: the events a killed relay had
+// in flight are still unpublished, so its successor produces them again.
+type Relay struct {
+	kConfig      cfg.KafkaConfig
+	pool         *pgxpool.Pool
+	tables       tables
+	relayCfg     cfg.OutboxRelayConfig
+	logBatchSize int
+	// mu guards the stats, which are shared by every incarnation
+	mu     sync.Mutex
+	stats  RelayStats
+	lagSum float64
+}
+
+func newRelay(kConfig cfg.KafkaConfig, pool *pgxpool.Pool, tables tables, relayCfg cfg.OutboxRelayConfig) (*Relay, error) {
+	switch relayCfg.Mode {
+	case "":
+		relayCfg.Mode = cfg.RelayPoll
+	case cfg.RelayPoll, cfg.RelayNotify:
+	default:
+		return nil, fmt.Errorf("unknown outbox relay mode %q", relayCfg.Mode)
+	}
+	if relayCfg.PollInterval <= 0 {
+		relayCfg.PollInterval = defaultPollInterval
+	}
+	if relayCfg.BatchSize <= 0 {
+		relayCfg.BatchSize = defaultBatchSize
+	}
+	if relayCfg.MaxInFlight <= 0 {
+		relayCfg.MaxInFlight = defaultMaxInFlight
+	}
+	logBatchSize := relayCfg.LogBatchSize
+	if logBatchSize <= 0 {
+		logBatchSize = config.DefaultLogBatchSize
+	}
+	return &Relay{
+		kConfig:      kConfig,
+		pool:         pool,
+		tables:       tables,
+		relayCfg:     relayCfg,
+		logBatchSize: logBatchSize,
+		stats:        RelayStats{Mode: relayCfg.Mode},
+	}, nil
+}
+
+func (r *Relay) GetPlugin() model.Plugin {
+	return r
+}
+
+func (r *Relay) GetName() string {
+	return r.relayCfg.JobName
+}
+
+func (r *Relay) GetInitialDelayDuration() time.Duration {
+	return r.relayCfg.InitialDelayDuration
+}
+
+func (r *Relay) GetRunDuration() time.Duration {
+	return r.relayCfg.RunDuration
+}
+
+func (r *Relay) GetIntervalDuration() time.Duration {
+	return r.relayCfg.IntervalDuration
+}
+
+func (r *Relay) GetResult() interface{} {
+	return r.Stats()
+}
+
+func (r *Relay) Stats() RelayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	if stats.Published > 0 {
+		stats.MeanLagSeconds = r.lagSum / float64(stats.Published)
+	}
+	return stats
+}
+
+// Run starts relay incarnations, killing each after KillAfter, until the run ends.
+func (r *Relay) Run(ctx context.Context) {
+	log := logger.Ctx(ctx)
+	for {
+		runCtx, cancel := ctx, context.CancelFunc(func() {})
+		if r.relayCfg.KillAfter > 0 {
+			runCtx, cancel = context.WithTimeout(ctx, r.relayCfg.KillAfter)
+		}
+		producerJob, err := infra.NewProducerJob[Event](r.kConfig, &relayPlugin{
+			relay:    r,
+			inFlight: make(map[int64]struct{}),
+			acked:    make(chan struct{}, 1),
+		})
+		if err != nil {
+			cancel()
+			log.Error().Err(err).Msg("Failed to create outbox relay")
+			return
+		}
+		r.mu.Lock()
+		r.stats.Incarnations++
+		r.mu.Unlock()
+
+		producerJob.Run(runCtx)
+		killed := runCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		producerJob.Close()
+		if !killed {
+			if ctx.Err() == nil {
+				log.Error().Msg("Outbox relay stopped before the end of its run")
+			}
+			log.Info().Any("stats", r.Stats()).Msg("Finished relaying outbox events")
+			return
+		}
+
+		r.mu.Lock()
+		r.stats.Kills++
+		r.mu.Unlock()
+		metrics.OutboxRelayKills.WithLabelValues(r.relayCfg.JobName).Inc()
+		log.Warn().Any("stats", r.Stats()).Msg("Killed outbox relay, starting a new one")
+	}
+}
+
+// Close leaves the pool to the caller, which shares it with the writer.
+func (r *Relay) Close() {}
+
+// recordPublish records the lag of a published event and returns the events published.
+func (r *Relay) recordPublish(lagSeconds float64) int64 {
+	metrics.OutboxRelayLag.WithLabelValues(r.relayCfg.Mode).Observe(lagSeconds)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Published++
+	r.lagSum += lagSeconds
+	r.stats.MaxLagSeconds = max(r.stats.MaxLagSeconds, lagSeconds)
+	return r.stats.Published
+}
+
+// relayPlugin is one relay incarnation. Its in-flight events are only held in memory,
+// as they would be in a relay process, and are lost with it.
+type relayPlugin struct {
+	relay *Relay
+	// mu guards inFlight: events produced whose acknowledgement has not been handled
+	mu       sync.Mutex
+	inFlight map[int64]struct{}
+	// acked wakes up Payloads when an acknowledgement makes room for more events
+	acked chan struct{}
+}
+
+func (p *relayPlugin) GetName() string {
+	return p.relay.relayCfg.JobName
+}
+
+func (p *relayPlugin) GetInitialDelayDuration() time.Duration {
+	return 0
+}
+
+func (p *relayPlugin) GetRunDuration() time.Duration {
+	return p.relay.relayCfg.RunDuration
+}
+
+func (p *relayPlugin) GetIntervalDuration() time.Duration {
+	return p.relay.relayCfg.IntervalDuration
+}
+
+// Payloads polls the outbox for unpublished events, oldest first. Events are not
+// fetched by a cursor over their ids: ids are assigned at insert, so a transaction
+// committing late would leave an event behind the cursor.
+func (p *relayPlugin) Payloads(ctx context.Context) (<-chan Event, error) {
+	var listener *pgxpool.Conn
+	if p.relay.relayCfg.Mode == cfg.RelayNotify {
+		var err error
+		if listener, err = p.relay.pool.Acquire(ctx); err != nil {
+			return nil, fmt.Errorf("failed to acquire outbox listener: %w", err)
+		}
+		if _, err = listener.Exec(ctx, "LISTEN "+pgx.Identifier{p.relay.tables.channel()}.Sanitize()); err != nil {
+			listener.Release()
+			return nil, fmt.Errorf("failed to listen for outbox events: %w", err)
+		}
+	}
+
+	log := logger.Ctx(ctx)
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		if listener != nil {
+			defer func() {
+				_, _ = listener.Exec(context.Background(), "UNLISTEN *")
+				listener.Release()
+			}()
+		}
+		for ctx.Err() == nil {
+			room := p.relay.relayCfg.MaxInFlight - p.inFlightCount()
+			if room <= 0 {
+				p.waitForAck(ctx)
+				continue
+			}
+			limit := min(room, p.relay.relayCfg.BatchSize)
+			batch, err := p.fetch(ctx, limit)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error().Err(err).Msg("Failed to fetch outbox events")
+				}
+				p.waitForEvents(ctx, listener)
+				continue
+			}
+			for _, event := range batch {
+				p.mu.Lock()
+				p.inFlight[event.ID] = struct{}{}
+				p.mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case events <- event:
+				}
+			}
+			if len(batch) < limit {
+				p.waitForEvents(ctx, listener)
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (p *relayPlugin) inFlightCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.inFlight)
+}
+
+// fetch reads up to limit unpublished events that are not already in flight.
+func (p *relayPlugin) fetch(ctx context.Context, limit int) (events []Event, err error) {
+	p.mu.Lock()
+	inFlight := make([]int64, 0, len(p.inFlight))
+	for id := range p.inFlight {
+		inFlight = append(inFlight, id)
+	}
+	p.mu.Unlock()
+
+	start := time.Now()
+	defer func() { observe("select", start, err) }()
+	rows, err := p.relay.pool.Query(ctx, fmt.Sprintf(`SELECT id, entity_id, run_id, sequence, payload, created_at
+FROM %s WHERE published_at IS NULL AND NOT (id = ANY($1)) ORDER BY id LIMIT $2`, p.relay.tables.outbox),
+		inFlight, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event Event
+		if err = rows.Scan(&event.ID, &event.EntityID, &event.RunID, &event.Sequence, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p.relay.mu.Lock()
+	p.relay.stats.Fetched += int64(len(events))
+	p.relay.mu.Unlock()
+	return events, nil
+}
+
+// waitForEvents waits PollInterval, or in notify mode until the writer commits an event.
+func (p *relayPlugin) waitForEvents(ctx context.Context, listener *pgxpool.Conn) {
+	if listener == nil {
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.relay.relayCfg.PollInterval):
+		}
+		return
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, p.relay.relayCfg.PollInterval)
+	defer cancel()
+	// a timeout leaves the connection usable; the next poll runs either way
+	_, _ = listener.Conn().WaitForNotification(waitCtx)
+}
+
+func (p *relayPlugin) waitForAck(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-p.acked:
+	case <-time.After(p.relay.relayCfg.PollInterval):
+	}
+}
+
+// ProduceFailed releases an event that was not delivered, so that it is fetched again.
+func (p *relayPlugin) ProduceFailed(ctx context.Context, event Event, err error) {
+	logger.WithContext(ctx).Warn().Err(err).Int64("eventId", event.ID).Msg("Failed to relay outbox event")
+	p.release(event.ID)
+}
+
+// release removes an event from the in-flight events and wakes up Payloads.
+func (p *relayPlugin) release(eventID int64) {
+	p.mu.Lock()
+	delete(p.inFlight, eventID)
+	p.mu.Unlock()
+	select {
+	case p.acked <- struct{}{}:
+	default:
+	}
+}
+
+// ProduceMessageListener marks an acknowledged event as published. An event acknowledged
+// after it was marked by another incarnation is a duplicate, and is not marked again.
+func (p *relayPlugin) ProduceMessageListener(ctx context.Context, engine infra.ProducerJob[Event], msg *k.Message) (err error) {
+	eventID, _, ok := messageEvent(msg)
+	if !ok {
+		return fmt.Errorf("relayed message has no %s header", HeaderEventID)
+	}
+	defer p.release(eventID)
+
+	var lagSeconds float64
+	start := time.Now()
+	err = p.relay.pool.QueryRow(ctx, fmt.Sprintf(`UPDATE %s SET published_at = clock_timestamp()
+WHERE id = $1 AND published_at IS NULL
+RETURNING EXTRACT(EPOCH FROM published_at - created_at)::float8`, p.relay.tables.outbox), eventID).Scan(&lagSeconds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		observe("update", start, nil)
+		return nil
+	}
+	observe("update", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event %d as published: %w", eventID, err)
+	}
+
+	if published := p.relay.recordPublish(lagSeconds); published%int64(p.relay.logBatchSize) == 0 {
+		logger.WithContext(ctx).Info().
+			Int64("published", published).
+			Any("lagSeconds", lagSeconds).
+			Msg("relayed outbox events")
+	}
+	return nil
+}
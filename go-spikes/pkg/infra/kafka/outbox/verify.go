@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxListedEvents bounds the event ids listed in a Report
+const maxListedEvents = 100
+
+// Verifier consumes the relayed topic and counts the deliveries of every event of the
+// writer's run. Events of earlier runs, relayed late, are ignored.
+type Verifier struct {
+	pluginCfg cfg.ConsumerPluginConfig
+	runID     string
+	// mu guards deliveries, as messages may be handled by concurrent workers
+	mu         sync.Mutex
+	deliveries map[int64]int
+}
+
+func (v *Verifier) GetName() string {
+	return v.pluginCfg.JobName
+}
+
+func (v *Verifier) GetInitialDelayDuration() time.Duration {
+	return v.pluginCfg.InitialDelayDuration
+}
+
+func (v *Verifier) GetRunDuration() time.Duration {
+	return v.pluginCfg.RunDuration
+}
+
+func (v *Verifier) GetIntervalDuration() time.Duration {
+	return v.pluginCfg.IntervalDuration
+}
+
+func (v *Verifier) ConsumeMessageHandler(ctx context.Context, engine infra.ConsumerJob[Event], msg *k.Message) error {
+	if eventID, runID, ok := messageEvent(msg); ok && runID == v.runID {
+		v.mu.Lock()
+		v.deliveries[eventID]++
+		v.mu.Unlock()
+	}
+	if err := engine.AcceptMessage(ctx, msg); err != nil {
+		logger.WithContext(ctx).Error().Err(err).Msg("Failed to commit message")
+	}
+	return nil
+}
+
+// DuplicatedEvent is an event consumed more than once.
+type DuplicatedEvent struct {
+	ID         int64 `json:"id"`
+	Deliveries int   `json:"deliveries"`
+}
+
+// Report compares the outbox events of a run with what the verifier consumed:
+// * Written - events in the outbox, each committed with its entity change
+// * Published - events the relay marked as published
+// * Unpublished - events still in the outbox, relayed by a later run
+// * Delivered - distinct events consumed
+// * Lost - events never consumed, whether marked as published or not
+// * Duplicated - events consumed more than once, e.g. produced again after a kill
+// LostIDs and DuplicatedEvents list the first maxListedEvents of each. Lossless and
+// DuplicateFree are the pass/fail answers; the relay is at least once, so consumers that
+// must not see duplicates deduplicate on the event id header.
+type Report struct {
+	RunID            string            `json:"runId"`
+	Lossless         bool              `json:"lossless"`
+	DuplicateFree    bool              `json:"duplicateFree"`
+	Written          int64             `json:"written"`
+	Published        int64             `json:"published"`
+	Unpublished      int64             `json:"unpublished"`
+	Delivered        int64             `json:"delivered"`
+	Lost             int64             `json:"lost"`
+	Duplicated       int64             `json:"duplicated"`
+	LostIDs          []int64           `json:"lostIds,omitempty"`
+	DuplicatedEvents []DuplicatedEvent `json:"duplicatedEvents,omitempty"`
+	Writer           WriterStats       `json:"writer"`
+	Relay            RelayStats        `json:"relay"`
+}
+
+// Spike wires the writer, the relay and the verifier to one outbox.
+type Spike struct {
+	pool     *pgxpool.Pool
+	tables   tables
+	Writer   *Writer
+	Relay    *Relay
+	Verifier *Verifier
+}
+
+// NewSpike creates the spike's tables. The pool is shared by the writer and the relay,
+// and stays owned by the caller.
+func NewSpike(ctx context.Context, pool *pgxpool.Pool, kConfig cfg.KafkaConfig, oc cfg.OutboxConfig) (*Spike, error) {
+	tables, err := newTables(oc)
+	if err != nil {
+		return nil, err
+	}
+	relay, err := newRelay(kConfig, pool, tables, oc.Relay)
+	if err != nil {
+		return nil, err
+	}
+	if err = tables.create(ctx, pool); err != nil {
+		return nil, err
+	}
+	writer := newWriter(pool, tables, oc.Writer)
+	return &Spike{
+		pool:   pool,
+		tables: tables,
+		Writer: writer,
+		Relay:  relay,
+		Verifier: &Verifier{
+			pluginCfg:  oc.Verifier,
+			runID:      writer.RunID(),
+			deliveries: make(map[int64]int),
+		},
+	}, nil
+}
+
+// Verify must only be called once the writer, the relay and the verifier have finished.
+func (s *Spike) Verify(ctx context.Context) (Report, error) {
+	report := Report{
+		RunID:  s.Writer.RunID(),
+		Writer: s.Writer.Stats(),
+		Relay:  s.Relay.Stats(),
+	}
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(
+		"SELECT id, published_at IS NOT NULL FROM %s WHERE run_id = $1 ORDER BY id", s.tables.outbox),
+		report.RunID)
+	if err != nil {
+		return report, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	s.Verifier.mu.Lock()
+	defer s.Verifier.mu.Unlock()
+	for rows.Next() {
+		var id int64
+		var published bool
+		if err = rows.Scan(&id, &published); err != nil {
+			return report, fmt.Errorf("failed to read outbox events: %w", err)
+		}
+		report.Written++
+		if published {
+			report.Published++
+		} else {
+			report.Unpublished++
+		}
+		deliveries := s.Verifier.deliveries[id]
+		switch {
+		case deliveries == 0:
+			report.Lost++
+			if len(report.LostIDs) < maxListedEvents {
+				report.LostIDs = append(report.LostIDs, id)
+			}
+		case deliveries > 1:
+			report.Duplicated++
+			if len(report.DuplicatedEvents) < maxListedEvents {
+				report.DuplicatedEvents = append(report.DuplicatedEvents, DuplicatedEvent{ID: id, Deliveries: deliveries})
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return report, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+	report.Delivered = int64(len(s.Verifier.deliveries))
+	report.Lossless = report.Lost == 0
+	report.DuplicateFree = report.Duplicated == 0
+	return report, nil
+}
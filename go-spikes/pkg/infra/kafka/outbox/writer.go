@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/infra-bed/go-spikes/pkg/config"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/infra/kafka/entityrepo"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/model"
+	"github.com/infra-bed/go-spikes/pkg/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WriterStats counts the entity changes of a writer run:
+// * Written - changes committed together with their outbox event
+// * Failures - transactions that were rolled back, leaving neither behind
+type WriterStats struct {
+	RunID    string `json:"runId"`
+	Written  int64  `json:"written"`
+	Failures int64  `json:"failures"`
+}
+
+// Writer plays the application of the outbox pattern. It writes every generated entity
+// change and its outbox event in one transaction, so that an event exists if and only if
+// its change was committed, and notifies the relay on commit.
+type Writer struct {
+	pool         *pgxpool.Pool
+	tables       tables
+	pluginCfg    cfg.ProducerPluginConfig
+	runID        string
+	logBatchSize int
+	written      atomic.Int64
+	failures     atomic.Int64
+}
+
+func newWriter(pool *pgxpool.Pool, tables tables, pluginCfg cfg.ProducerPluginConfig) *Writer {
+	logBatchSize := pluginCfg.LogBatchSize
+	if logBatchSize <= 0 {
+		logBatchSize = config.DefaultLogBatchSize
+	}
+	return &Writer{
+		pool:         pool,
+		tables:       tables,
+		pluginCfg:    pluginCfg,
+		runID:        uuid.New().String(),
+		logBatchSize: logBatchSize,
+	}
+}
+
+func (w *Writer) GetPlugin() model.Plugin {
+	return w
+}
+
+func (w *Writer) GetName() string {
+	return w.pluginCfg.JobName
+}
+
+func (w *Writer) GetInitialDelayDuration() time.Duration {
+	return w.pluginCfg.InitialDelayDuration
+}
+
+func (w *Writer) GetRunDuration() time.Duration {
+	return w.pluginCfg.RunDuration
+}
+
+func (w *Writer) GetIntervalDuration() time.Duration {
+	return w.pluginCfg.IntervalDuration
+}
+
+// RunID identifies the events of this writer in the outbox and in their headers.
+func (w *Writer) RunID() string {
+	return w.runID
+}
+
+func (w *Writer) GetResult() interface{} {
+	return w.Stats()
+}
+
+func (w *Writer) Stats() WriterStats {
+	return WriterStats{
+		RunID:    w.runID,
+		Written:  w.written.Load(),
+		Failures: w.failures.Load(),
+	}
+}
+
+func (w *Writer) Run(ctx context.Context) {
+	log := logger.Ctx(ctx)
+	payloads, err := entityrepo.GeneratePayloads(ctx, w.pluginCfg, w.runID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate Payloads")
+		return
+	}
+	intervalTimer := model.NewIntervalTimer(ctx, w)
+	for payload := range payloads {
+		intervalTimer.NextTickWait()
+		if ctx.Err() != nil {
+			break
+		}
+		if err = w.write(ctx, payload); err != nil {
+			w.failures.Add(1)
+			if ctx.Err() == nil {
+				log.Error().Err(err).Str("entityId", payload.EntityID).Msg("Failed to write entity and outbox event")
+			}
+			continue
+		}
+		if written := w.written.Add(1); written%int64(w.logBatchSize) == 0 {
+			log.Info().Int64("written", written).Msg("wrote outbox events")
+		}
+	}
+	log.Info().Any("stats", w.Stats()).Msg("Finished writing outbox events")
+}
+
+// Close leaves the pool to the caller, which shares it with the relay.
+func (w *Writer) Close() {}
+
+// write applies the entity change and inserts its outbox event in one transaction.
+func (w *Writer) write(ctx context.Context, payload entityrepo.Payload) (err error) {
+	operation := "upsert"
+	if payload.Deleted {
+		operation = "delete"
+	}
+	ctx, span := tracing.StartSpanWithAttributes(
+		ctx,
+		"outbox.writer.write",
+		tracing.DatabaseAttributes(databaseType, w.tables.entity, operation),
+	)
+	defer span.End()
+	defer func() {
+		if err != nil {
+			tracing.RecordError(span, err, "Failed to write entity and outbox event")
+		}
+	}()
+
+	var value []byte
+	if !payload.Deleted {
+		if value, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+	}
+
+	start := time.Now()
+	tx, err := w.pool.Begin(ctx)
+	observe("begin", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// a no-op once the transaction is committed
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if payload.Deleted {
+		err = w.exec(ctx, tx, operation, fmt.Sprintf("DELETE FROM %s WHERE entity_id = $1", w.tables.entity),
+			payload.EntityID)
+	} else {
+		err = w.exec(ctx, tx, operation, fmt.Sprintf(`INSERT INTO %[1]s (entity_id, payload, version, updated_at)
+VALUES ($1, $2, 1, clock_timestamp())
+ON CONFLICT (entity_id) DO UPDATE SET payload = EXCLUDED.payload, version = %[1]s.version + 1,
+	updated_at = EXCLUDED.updated_at`, w.tables.entity),
+			payload.EntityID, value)
+	}
+	if err != nil {
+		return err
+	}
+	if err = w.exec(ctx, tx, "insert", fmt.Sprintf(
+		"INSERT INTO %s (entity_id, run_id, sequence, payload) VALUES ($1, $2, $3, $4)", w.tables.outbox),
+		payload.EntityID, w.runID, payload.Sequence, value); err != nil {
+		return err
+	}
+	// delivered to listening relays only once the transaction commits
+	if err = w.exec(ctx, tx, "notify", "SELECT pg_notify($1, '')", w.tables.channel()); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	err = tx.Commit(ctx)
+	observe("commit", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (w *Writer) exec(ctx context.Context, tx pgx.Tx, operation, query string, args ...interface{}) error {
+	start := time.Now()
+	_, err := tx.Exec(ctx, query, args...)
+	observe(operation, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", operation, err)
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/model"
 )
 
 type ProducerPlugin[T any] interface {
@@ -16,6 +18,13 @@ type ProducerPlugin[T any] interface {
 	GetIntervalDuration() time.Duration
 }
 
+// ProduceFailureListener is implemented by producer plugins that track the payloads they
+// hand out, e.g. to hand them out again. ProduceFailed is called with a payload that could
+// not be produced, or whose delivery Kafka reported as failed.
+type ProduceFailureListener[T any] interface {
+	ProduceFailed(ctx context.Context, payload T, err error)
+}
+
 type ConsumerPlugin[T any] interface {
 	GetName() string
 	ConsumeMessageHandler(ctx context.Context, engine ConsumerJob[T], message *k.Message) error
@@ -23,3 +32,67 @@ type ConsumerPlugin[T any] interface {
 	GetRunDuration() time.Duration
 	GetIntervalDuration() time.Duration
 }
+
+// BatchConsumerPlugin is implemented by consumer plugins that can handle polled messages
+// in batches. It is used instead of ConsumeMessageHandler when ConsumerConfig.Batch is enabled.
+// The consumer commits once the whole batch is handled, so the handler must not accept messages.
+type BatchConsumerPlugin[T any] interface {
+	ConsumeBatchHandler(ctx context.Context, engine ConsumerJob[T], messages []*k.Message) error
+}
+
+// OffsetListener is implemented by consumer plugins that keep state alongside the
+// consumed offsets. OffsetsDone receives, per partition, the next offset to consume once
+// every earlier message has been handled, even when messages finish out of order.
+type OffsetListener interface {
+	OffsetsDone(offsets []k.TopicPartition)
+}
+
+// KeyedPayload is implemented by payloads that choose their own message key,
+// e.g. an entity id for compacted topics. Other payloads are keyed by a hash of their value.
+type KeyedPayload interface {
+	MessageKey() []byte
+}
+
+// TombstonePayload is implemented by payloads that may represent a delete,
+// which is produced as a message with a null value.
+type TombstonePayload interface {
+	IsTombstone() bool
+}
+
+// HeaderedPayload is implemented by payloads that carry metadata in message headers,
+// which is also available for tombstones.
+type HeaderedPayload interface {
+	MessageHeaders() []k.Header
+}
+
+// RawPayload is implemented by payloads that carry an already encoded value, e.g.
+// replayed messages, which is produced as is instead of being marshalled to JSON.
+type RawPayload interface {
+	MessageValue() []byte
+}
+
+// NewJobPlugin provides the model.Plugin name and timings for jobs, such as the
+// dead letter replay, that have no payload handling of their own.
+func NewJobPlugin(pluginCfg cfg.ConsumerPluginConfig) model.Plugin {
+	return &jobPlugin{pluginCfg: pluginCfg}
+}
+
+type jobPlugin struct {
+	pluginCfg cfg.ConsumerPluginConfig
+}
+
+func (j *jobPlugin) GetName() string {
+	return j.pluginCfg.JobName
+}
+
+func (j *jobPlugin) GetInitialDelayDuration() time.Duration {
+	return j.pluginCfg.InitialDelayDuration
+}
+
+func (j *jobPlugin) GetRunDuration() time.Duration {
+	return j.pluginCfg.RunDuration
+}
+
+func (j *jobPlugin) GetIntervalDuration() time.Duration {
+	return j.pluginCfg.IntervalDuration
+}
@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+)
+
+const defaultInFlightPerWorker = 100
+
+// messageProcessor handles messages on a pool of workers. Messages with the same
+// partition (or key) always go to the same worker, so they are handled in order.
+// Offsets are stored only once every earlier message of the partition is done (the
+// job's offsetCommitter decides when they are committed), and
+// dispatch blocks once MaxInFlight messages are unfinished, pausing the poll loop.
+type messageProcessor[T any] struct {
+	job      *consumerJobImpl[T]
+	orderBy  string
+	workers  []chan dispatchedMessage
+	inFlight chan struct{}
+	running  sync.WaitGroup
+	pending  sync.WaitGroup
+
+	mu       sync.Mutex
+	trackers map[string]*offsetTracker
+}
+
+type dispatchedMessage struct {
+	ctx     context.Context
+	message *k.Message
+}
+
+func newMessageProcessor[T any](job *consumerJobImpl[T], concurrency cfg.ConcurrencyConfig) *messageProcessor[T] {
+	maxInFlight := concurrency.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = concurrency.Workers * defaultInFlightPerWorker
+	}
+	p := &messageProcessor[T]{
+		job:      job,
+		orderBy:  concurrency.OrderBy,
+		workers:  make([]chan dispatchedMessage, concurrency.Workers),
+		inFlight: make(chan struct{}, maxInFlight),
+		trackers: make(map[string]*offsetTracker),
+	}
+	for i := range p.workers {
+		p.workers[i] = make(chan dispatchedMessage, maxInFlight)
+	}
+	return p
+}
+
+func (p *messageProcessor[T]) start() {
+	for _, worker := range p.workers {
+		p.running.Add(1)
+		go func(messages <-chan dispatchedMessage) {
+			defer p.running.Done()
+			for dispatched := range messages {
+				_, done := p.job.handleMessage(dispatched.ctx, dispatched.message)
+				p.complete(dispatched.message, done)
+			}
+		}(worker)
+	}
+}
+
+// dispatch hands the message to its worker. It returns false if ctx is done while
+// waiting for an in-flight slot.
+func (p *messageProcessor[T]) dispatch(ctx context.Context, message *k.Message) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case p.inFlight <- struct{}{}:
+	}
+
+	p.mu.Lock()
+	tracker, ok := p.trackers[partitionLabel(message.TopicPartition)]
+	if !ok {
+		tracker = &offsetTracker{done: make(map[k.Offset]bool)}
+		p.trackers[partitionLabel(message.TopicPartition)] = tracker
+	}
+	tracker.add(message.TopicPartition.Offset)
+	p.mu.Unlock()
+
+	p.pending.Add(1)
+	p.workers[p.workerIndex(message)] <- dispatchedMessage{ctx: ctx, message: message}
+	return true
+}
+
+func (p *messageProcessor[T]) workerIndex(message *k.Message) int {
+	hash := fnv.New32a()
+	if p.orderBy == cfg.OrderByKey && message.Key != nil {
+		hash.Write(message.Key)
+	} else {
+		hash.Write([]byte(partitionLabel(message.TopicPartition)))
+	}
+	return int(hash.Sum32() % uint32(len(p.workers)))
+}
+
+// complete marks the message done and stores the offset after the contiguous run of
+// finished messages of its partition. A message that is not done keeps the offsets of its
+// partition from advancing past it, so it is consumed again after a restart.
+func (p *messageProcessor[T]) complete(message *k.Message, done bool) {
+	defer p.pending.Done()
+	defer func() { <-p.inFlight }()
+	if !done {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tracker, ok := p.trackers[partitionLabel(message.TopicPartition)]
+	if !ok {
+		// the partition was revoked while the message was in flight
+		return
+	}
+	next, advanced := tracker.markDone(message.TopicPartition.Offset)
+	if !advanced {
+		return
+	}
+	topicPartition := message.TopicPartition
+	topicPartition.Offset = next
+	if _, err := p.job.consumer.StoreOffsets([]k.TopicPartition{topicPartition}); err != nil {
+		logger.Get().Error().
+			Err(err).
+			Int32("partition", topicPartition.Partition).
+			Int64("offset", int64(next)).
+			Msg("Failed to store offset")
+		return
+	}
+	if p.job.committer != nil {
+		p.job.committer.stored(1)
+	}
+	p.job.offsetsDone([]k.TopicPartition{topicPartition})
+}
+
+// drain waits until every dispatched message is done.
+func (p *messageProcessor[T]) drain() {
+	p.pending.Wait()
+}
+
+// forget drops the offset tracking of revoked partitions; it must follow a drain.
+func (p *messageProcessor[T]) forget(partitions []k.TopicPartition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, partition := range partitions {
+		delete(p.trackers, partitionLabel(partition))
+	}
+}
+
+func (p *messageProcessor[T]) stop() {
+	p.drain()
+	for _, worker := range p.workers {
+		close(worker)
+	}
+	p.running.Wait()
+}
+
+// offsetTracker keeps a partition's dispatched offsets in order, so the committable
+// offset only advances past messages whose predecessors are all done.
+type offsetTracker struct {
+	pending []k.Offset
+	done    map[k.Offset]bool
+}
+
+func (t *offsetTracker) add(offset k.Offset) {
+	t.pending = append(t.pending, offset)
+}
+
+func (t *offsetTracker) markDone(offset k.Offset) (k.Offset, bool) {
+	t.done[offset] = true
+	var next k.Offset
+	advanced := false
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		delete(t.done, t.pending[0])
+		next = t.pending[0] + 1
+		t.pending = t.pending[1:]
+		advanced = true
+	}
+	return next, advanced
+}
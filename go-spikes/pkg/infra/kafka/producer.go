@@ -5,7 +5,6 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/infra-bed/go-spikes/pkg/config"
@@ -23,13 +22,20 @@ type ProducerJob[T any] interface {
 }
 
 func NewProducerJob[T any](cfg cfg.KafkaConfig, plugin ProducerPlugin[T]) (model.Job, error) {
-	configMap := &k.ConfigMap{
-		"bootstrap.servers": strings.Join(cfg.Brokers, ","),
-		"client.id":         cfg.ProducerConfig.ClientId,
-		"acks":              cfg.ProducerConfig.Acks,
-		"retries":           10,
-		"linger.ms":         10,
-		"compression.type":  cfg.ProducerConfig.CompressionType,
+	configMap, err := newClientConfigMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]k.ConfigValue{
+		"client.id":        cfg.ProducerConfig.ClientId,
+		"acks":             cfg.ProducerConfig.Acks,
+		"retries":          10,
+		"linger.ms":        10,
+		"compression.type": cfg.ProducerConfig.CompressionType,
+	} {
+		if err = configMap.SetKey(key, value); err != nil {
+			return nil, err
+		}
 	}
 
 	producer, err := k.NewProducer(configMap)
@@ -115,6 +121,7 @@ func (p *producerJobImpl[T]) producePayloads(ctx context.Context, payloadChan <-
 			if err := p.producePayloadAsync(batchCtx, payload); err != nil {
 				log.Error().Err(err).Msg("Failed to produce payload")
 				metrics.KafkaProduceErrors.WithLabelValues(p.config.Topic, "produce_error").Inc()
+				p.produceFailed(ctx, payload, err)
 				continue
 			}
 			count++
@@ -143,7 +150,9 @@ func (p *producerJobImpl[T]) producePayloads(ctx context.Context, payloadChan <-
 }
 
 // producePayloadAsync produces a single payload asynchronously.
-// It marshals the payload to JSON, computes a SHA-256 hash for the key.
+// It marshals the payload to JSON, computes a SHA-256 hash for the key unless the
+// payload is a KeyedPayload, and sends a null value for a TombstonePayload. The value of
+// a RawPayload is sent as is. Headers of a HeaderedPayload are added to the message.
 // An alternative would be to produce messages transactionally.
 func (p *producerJobImpl[T]) producePayloadAsync(ctx context.Context, payload interface{}) error {
 	ctx, span := tracing.StartSpanWithAttributes(
@@ -153,16 +162,26 @@ func (p *producerJobImpl[T]) producePayloadAsync(ctx context.Context, payload in
 	)
 	defer span.End()
 
-	data, err := json.Marshal(payload)
-	if err != nil {
-		tracing.RecordError(span, err, "Failed to marshal payload")
-		return fmt.Errorf("failed to marshal payload: %w", err)
+	var data []byte
+	if raw, ok := payload.(RawPayload); ok {
+		data = raw.MessageValue()
+	} else if tombstone, ok := payload.(TombstonePayload); !ok || !tombstone.IsTombstone() {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			tracing.RecordError(span, err, "Failed to marshal payload")
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
 	}
 
 	// Record message size
 	metrics.KafkaMessageSize.WithLabelValues(p.config.Topic, "produce").Observe(float64(len(data)))
 
-	key := sha256.New().Sum(data)
+	var key []byte
+	if keyed, ok := payload.(KeyedPayload); ok {
+		key = keyed.MessageKey()
+	} else {
+		key = sha256.New().Sum(data)
+	}
 	msg := &k.Message{
 		TopicPartition: k.TopicPartition{
 			Topic:     &p.config.Topic,
@@ -170,6 +189,11 @@ func (p *producerJobImpl[T]) producePayloadAsync(ctx context.Context, payload in
 		},
 		Key:   key,
 		Value: data,
+		// the delivery report hands the payload back to a ProduceFailureListener
+		Opaque: payload,
+	}
+	if headered, ok := payload.(HeaderedPayload); ok {
+		msg.Headers = headered.MessageHeaders()
 	}
 
 	if err := p.producer.Produce(msg, p.deliveryChan); err != nil {
@@ -181,6 +205,13 @@ func (p *producerJobImpl[T]) producePayloadAsync(ctx context.Context, payload in
 	return nil
 }
 
+// produceFailed hands a payload that was not delivered back to a plugin listening for it.
+func (p *producerJobImpl[T]) produceFailed(ctx context.Context, payload T, err error) {
+	if listener, ok := p.plugin.(ProduceFailureListener[T]); ok {
+		listener.ProduceFailed(ctx, payload, err)
+	}
+}
+
 func (p *producerJobImpl[T]) messageDeliveryEventHandler(ctx context.Context) {
 	log := logger.Ctx(ctx)
 	counts := make(map[string]int)
@@ -201,6 +232,9 @@ func (p *producerJobImpl[T]) messageDeliveryEventHandler(ctx context.Context) {
 						Str("key", string(ev.Key)).
 						Msg("Delivery failed")
 					metrics.KafkaProduceErrors.WithLabelValues(p.config.Topic, "delivery_failed").Inc()
+					if payload, ok := ev.Opaque.(T); ok {
+						p.produceFailed(ctx, payload, ev.TopicPartition.Error)
+					}
 				} else {
 					err := p.plugin.ProduceMessageListener(ctx, p, ev)
 					if err != nil {
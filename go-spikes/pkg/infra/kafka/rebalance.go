@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	RebalanceAssigned = "assigned"
+	RebalanceRevoked  = "revoked"
+	RebalanceLost     = "lost"
+)
+
+// AssignmentReporter is implemented by jobs that can report their current partition assignment.
+type AssignmentReporter interface {
+	GetAssignment() ([]PartitionAssignment, error)
+}
+
+type PartitionAssignment struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+}
+
+// RebalanceEvent is a single entry of a consumer's rebalance timeline.
+type RebalanceEvent struct {
+	Time       time.Time             `json:"time"`
+	Type       string                `json:"type"`
+	Protocol   string                `json:"protocol"`
+	Partitions []PartitionAssignment `json:"partitions"`
+}
+
+func toPartitionAssignments(partitions []k.TopicPartition) []PartitionAssignment {
+	assignments := make([]PartitionAssignment, 0, len(partitions))
+	for _, partition := range partitions {
+		topic := ""
+		if partition.Topic != nil {
+			topic = *partition.Topic
+		}
+		assignments = append(assignments, PartitionAssignment{
+			Topic:     topic,
+			Partition: partition.Partition,
+		})
+	}
+	return assignments
+}
+
+func (c *consumerJobImpl[T]) GetAssignment() ([]PartitionAssignment, error) {
+	partitions, err := c.consumer.Assignment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment: %w", err)
+	}
+	return toPartitionAssignments(partitions), nil
+}
+
+// rebalancedSince reports whether an assign or revoke was recorded after t.
+func (c *consumerJobImpl[T]) rebalancedSince(t time.Time) bool {
+	c.resultMu.Lock()
+	defer c.resultMu.Unlock()
+	return len(c.rebalances) > 0 && c.rebalances[len(c.rebalances)-1].Time.After(t)
+}
+
+// rebalanceCallback logs, traces and records every assign/revoke. Partitions are
+// (un)assigned by the client after the callback returns, which also covers the
+// incremental assignment of the cooperative-sticky strategy.
+func (c *consumerJobImpl[T]) rebalanceCallback(consumer *k.Consumer, event k.Event) error {
+	var eventType string
+	var partitions []k.TopicPartition
+
+	switch ev := event.(type) {
+	case k.AssignedPartitions:
+		eventType = RebalanceAssigned
+		partitions = ev.Partitions
+	case k.RevokedPartitions:
+		eventType = RebalanceRevoked
+		partitions = ev.Partitions
+		if consumer.AssignmentLost() {
+			eventType = RebalanceLost
+		}
+	default:
+		return nil
+	}
+
+	ctx, span := tracing.StartSpanWithAttributes(
+		c.running(),
+		"kafka.consumer.rebalance",
+		tracing.KafkaAttributes(c.connectionConfig.Topic, "any", "rebalance"),
+	)
+	defer span.End()
+	log := logger.Ctx(ctx)
+
+	protocol := consumer.GetRebalanceProtocol()
+	tracing.SetSpanAttributes(span,
+		attribute.String("messaging.kafka.rebalance.type", eventType),
+		attribute.String("messaging.kafka.rebalance.protocol", protocol),
+		attribute.Int("messaging.kafka.rebalance.partitions", len(partitions)),
+	)
+
+	// finish in-flight messages so their offsets can be committed before the partitions move
+	if c.processor != nil && eventType != RebalanceAssigned {
+		c.processor.drain()
+		defer c.processor.forget(partitions)
+	}
+
+	// commit what has been processed before the partitions move to another member
+	if eventType == RebalanceRevoked && c.committer != nil {
+		c.committer.drain()
+		if err := c.committer.commit(); err != nil {
+			tracing.RecordError(span, err, "Failed to commit on revoke")
+			log.Error().Err(err).Msg("Failed to commit offsets on revoke")
+		}
+	}
+
+	if eventType == RebalanceAssigned {
+		if err := c.assignFromStartPosition(consumer, partitions); err != nil {
+			// the client falls back to assigning at the committed offsets
+			tracing.RecordError(span, err, "Failed to assign at start position")
+			log.Error().Err(err).Msg("Failed to assign partitions at start position")
+		}
+	}
+
+	assignments := toPartitionAssignments(partitions)
+	c.recordRebalance(RebalanceEvent{
+		Time:       time.Now(),
+		Type:       eventType,
+		Protocol:   protocol,
+		Partitions: assignments,
+	})
+
+	partitionIds := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		partitionIds = append(partitionIds, assignment.Topic+"/"+strconv.Itoa(int(assignment.Partition)))
+	}
+	log.Info().
+		Str("type", eventType).
+		Str("protocol", protocol).
+		Str("group", c.connectionConfig.ConsumerConfig.ConsumerGroup).
+		Any("partitions", partitionIds).
+		Msg("Consumer rebalance")
+	return nil
+}
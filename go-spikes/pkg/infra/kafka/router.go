@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/model"
+)
+
+// MessageHandler has the signature of ConsumerPlugin.ConsumeMessageHandler, so a
+// plugin's method value can be used as the handler of a TopicRoute.
+type MessageHandler[T any] func(ctx context.Context, engine ConsumerJob[T], message *k.Message) error
+
+// TopicRoute sends the messages of the topics matching Pattern to Handler. A pattern
+// starting with "^" is a regular expression, as in the subscription; any other
+// pattern matches a single topic.
+type TopicRoute[T any] struct {
+	Pattern string
+	Handler MessageHandler[T]
+}
+
+// RoutedConsumerPlugin is implemented by consumer plugins whose handlers can be chosen
+// per topic through ConsumerConfig.Routes, keyed by the names the routes refer to.
+type RoutedConsumerPlugin[T any] interface {
+	TopicHandlers() map[string]MessageHandler[T]
+}
+
+// routeByConfig wraps plugin in a router built from the configured routes.
+func routeByConfig[T any](plugin ConsumerPlugin[T], routes []cfg.TopicRouteConfig) (ConsumerPlugin[T], error) {
+	routed, ok := plugin.(RoutedConsumerPlugin[T])
+	if !ok {
+		return nil, fmt.Errorf("plugin %s does not support topic routes", plugin.GetName())
+	}
+	handlers := routed.TopicHandlers()
+	topicRoutes := make([]TopicRoute[T], 0, len(routes))
+	for _, route := range routes {
+		handler, ok := handlers[route.Handler]
+		if !ok {
+			return nil, fmt.Errorf("plugin %s has no handler %q for topic route %q", plugin.GetName(), route.Handler, route.Pattern)
+		}
+		topicRoutes = append(topicRoutes, TopicRoute[T]{Pattern: route.Pattern, Handler: handler})
+	}
+	return NewTopicRouter(plugin, topicRoutes...)
+}
+
+// NewTopicRouter wraps plugin so that messages of a multi-topic subscription go to the
+// handler of the first matching route, and to the plugin's own ConsumeMessageHandler
+// otherwise. The router handles messages one at a time, so a batch-capable plugin is
+// consumed per message when it is routed.
+func NewTopicRouter[T any](plugin ConsumerPlugin[T], routes ...TopicRoute[T]) (ConsumerPlugin[T], error) {
+	router := &topicRouter[T]{ConsumerPlugin: plugin}
+	for _, route := range routes {
+		compiled := compiledRoute[T]{topic: route.Pattern, handler: route.Handler}
+		if cfg.IsTopicPattern(route.Pattern) {
+			pattern, err := regexp.Compile(route.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid topic pattern %q: %w", route.Pattern, err)
+			}
+			compiled.pattern = pattern
+		}
+		router.routes = append(router.routes, compiled)
+	}
+	return router, nil
+}
+
+type compiledRoute[T any] struct {
+	topic   string
+	pattern *regexp.Regexp
+	handler MessageHandler[T]
+}
+
+func (r compiledRoute[T]) matches(topic string) bool {
+	if r.pattern != nil {
+		return r.pattern.MatchString(topic)
+	}
+	return r.topic == topic
+}
+
+type topicRouter[T any] struct {
+	ConsumerPlugin[T]
+	routes []compiledRoute[T]
+	// handlers caches the resolved handler per topic; messages may be handled by
+	// concurrent workers
+	handlers sync.Map
+}
+
+// ConsumeMessageHandler routes by the topic the message was first consumed from, so a
+// retried message reaches the same handler as on its first attempt.
+func (r *topicRouter[T]) ConsumeMessageHandler(ctx context.Context, engine ConsumerJob[T], message *k.Message) error {
+	topic := headerValue(message, HeaderOriginalTopic)
+	if topic == "" {
+		topic = *message.TopicPartition.Topic
+	}
+	return r.handlerFor(topic)(ctx, engine, message)
+}
+
+// GetResult reports the result of the routed plugin, if it has one.
+func (r *topicRouter[T]) GetResult() interface{} {
+	if reporter, ok := r.ConsumerPlugin.(model.ResultReporter); ok {
+		return reporter.GetResult()
+	}
+	return nil
+}
+
+// OffsetsDone passes handled offsets on to the routed plugin, if it listens for them.
+func (r *topicRouter[T]) OffsetsDone(offsets []k.TopicPartition) {
+	if listener, ok := r.ConsumerPlugin.(OffsetListener); ok {
+		listener.OffsetsDone(offsets)
+	}
+}
+
+func (r *topicRouter[T]) handlerFor(topic string) MessageHandler[T] {
+	if handler, ok := r.handlers.Load(topic); ok {
+		return handler.(MessageHandler[T])
+	}
+	handler := MessageHandler[T](r.ConsumerPlugin.ConsumeMessageHandler)
+	for _, route := range r.routes {
+		if route.matches(topic) {
+			handler = route.handler
+			break
+		}
+	}
+	r.handlers.Store(topic, handler)
+	return handler
+}
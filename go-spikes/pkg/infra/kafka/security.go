@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+)
+
+// newClientConfigMap builds the librdkafka settings shared by producers, consumers
+// and admin clients: the bootstrap servers plus any SASL/TLS settings.
+func newClientConfigMap(kc cfg.KafkaConfig) (*k.ConfigMap, error) {
+	configMap := &k.ConfigMap{
+		"bootstrap.servers": strings.Join(kc.Brokers, ","),
+	}
+	if err := applySecurityConfig(configMap, kc.Security); err != nil {
+		return nil, err
+	}
+	return configMap, nil
+}
+
+func applySecurityConfig(configMap *k.ConfigMap, sc cfg.SecurityConfig) error {
+	settings := make(k.ConfigMap)
+
+	if sc.Protocol != "" {
+		settings["security.protocol"] = sc.Protocol
+	}
+
+	if sc.SaslMechanism != "" {
+		settings["sasl.mechanisms"] = sc.SaslMechanism
+
+		username := sc.Username
+		if sc.UsernameFile != "" {
+			value, err := readSecretFile(sc.UsernameFile)
+			if err != nil {
+				return err
+			}
+			username = value
+		}
+		if username == "" {
+			return fmt.Errorf("sasl mechanism %s requires a username", sc.SaslMechanism)
+		}
+		settings["sasl.username"] = username
+
+		if sc.PasswordFile == "" {
+			return fmt.Errorf("sasl mechanism %s requires a passwordFile", sc.SaslMechanism)
+		}
+		password, err := readSecretFile(sc.PasswordFile)
+		if err != nil {
+			return err
+		}
+		settings["sasl.password"] = password
+	}
+
+	if sc.CALocation != "" {
+		settings["ssl.ca.location"] = sc.CALocation
+	}
+	if sc.CertificateLocation != "" {
+		settings["ssl.certificate.location"] = sc.CertificateLocation
+	}
+	if sc.KeyLocation != "" {
+		settings["ssl.key.location"] = sc.KeyLocation
+	}
+	if sc.KeyPasswordFile != "" {
+		keyPassword, err := readSecretFile(sc.KeyPasswordFile)
+		if err != nil {
+			return err
+		}
+		settings["ssl.key.password"] = keyPassword
+	}
+
+	for key, value := range settings {
+		if err := configMap.SetKey(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSecretFile reads a value from a mounted Kubernetes secret, trimming the
+// trailing newline that secrets created from literals often carry.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
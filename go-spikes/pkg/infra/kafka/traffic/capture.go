@@ -0,0 +1,233 @@
+package traffic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/config"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+)
+
+const (
+	defaultMaxFileBytes = 64 << 20
+	// partSuffix marks the file being written, so that globs over the capture files
+	// only match complete ones
+	partSuffix = ".part"
+)
+
+// CaptureStats counts what a capture job has recorded:
+// * Messages and Bytes - the records written, and their uncompressed size
+// * Files - the complete files, in the order they were written
+type CaptureStats struct {
+	Messages int64    `json:"messages"`
+	Bytes    int64    `json:"bytes"`
+	Files    []string `json:"files"`
+}
+
+// CapturePlugin records every consumed message to rotating JSONL files.
+type CapturePlugin struct {
+	captureCfg   cfg.CaptureConfig
+	logBatchSize int
+	// mu guards the file and the stats, as messages may be handled by concurrent workers
+	mu     sync.Mutex
+	file   *captureFile
+	prefix string
+	stats  CaptureStats
+}
+
+func NewCapturePlugin(captureCfg cfg.CaptureConfig, topic string) (*CapturePlugin, error) {
+	if captureCfg.Dir == "" {
+		return nil, fmt.Errorf("capture dir is required")
+	}
+	if err := os.MkdirAll(captureCfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture dir: %w", err)
+	}
+	if captureCfg.MaxFileBytes <= 0 {
+		captureCfg.MaxFileBytes = defaultMaxFileBytes
+	}
+	prefix := captureCfg.FilePrefix
+	if prefix == "" {
+		prefix = topic
+	}
+	logBatchSize := captureCfg.LogBatchSize
+	if logBatchSize <= 0 {
+		logBatchSize = config.DefaultLogBatchSize
+	}
+	return &CapturePlugin{
+		captureCfg:   captureCfg,
+		logBatchSize: logBatchSize,
+		prefix:       prefix,
+		stats:        CaptureStats{Files: []string{}},
+	}, nil
+}
+
+func (c *CapturePlugin) GetName() string {
+	return c.captureCfg.JobName
+}
+
+func (c *CapturePlugin) GetInitialDelayDuration() time.Duration {
+	return c.captureCfg.InitialDelayDuration
+}
+
+func (c *CapturePlugin) GetRunDuration() time.Duration {
+	return c.captureCfg.RunDuration
+}
+
+func (c *CapturePlugin) GetIntervalDuration() time.Duration {
+	return c.captureCfg.IntervalDuration
+}
+
+func (c *CapturePlugin) GetResult() interface{} {
+	return c.Stats()
+}
+
+func (c *CapturePlugin) Stats() CaptureStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Files = append([]string(nil), c.stats.Files...)
+	return stats
+}
+
+// ConsumeMessageHandler writes the message before accepting it, so that a message whose
+// write failed is rejected instead.
+func (c *CapturePlugin) ConsumeMessageHandler(ctx context.Context, engine infra.ConsumerJob[Record], msg *k.Message) error {
+	line, err := json.Marshal(newRecord(msg))
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	err = c.write(line)
+	messages := c.stats.Messages
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if messages%int64(c.logBatchSize) == 0 {
+		logger.WithContext(ctx).Info().Int64("messages", messages).Msg("captured messages")
+	}
+
+	if err = engine.AcceptMessage(ctx, msg); err != nil {
+		logger.WithContext(ctx).Error().Err(err).Msg("Failed to commit message")
+	}
+	return nil
+}
+
+// write appends a line to the current file, rotating it first if it is full or too old;
+// the caller holds mu.
+func (c *CapturePlugin) write(line []byte) error {
+	if c.file != nil && c.file.full(int64(len(line)), c.captureCfg) {
+		if err := c.closeFile(); err != nil {
+			return err
+		}
+	}
+	if c.file == nil {
+		file, err := createCaptureFile(c.captureCfg, c.prefix)
+		if err != nil {
+			return err
+		}
+		c.file = file
+	}
+	if _, err := c.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write capture file %s: %w", c.file.path, err)
+	}
+	c.stats.Messages++
+	c.stats.Bytes += int64(len(line))
+	return nil
+}
+
+func (c *CapturePlugin) closeFile() error {
+	file := c.file
+	c.file = nil
+	if err := file.Close(); err != nil {
+		return err
+	}
+	c.stats.Files = append(c.stats.Files, file.path)
+	return nil
+}
+
+// Close completes the current file once the capture job has finished.
+func (c *CapturePlugin) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	return c.closeFile()
+}
+
+// captureFile is a capture file being written, under its path with partSuffix until it
+// is closed.
+type captureFile struct {
+	path    string
+	opened  time.Time
+	written int64
+	file    *os.File
+	gzip    *gzip.Writer
+	buf     *bufio.Writer
+}
+
+func createCaptureFile(captureCfg cfg.CaptureConfig, prefix string) (*captureFile, error) {
+	opened := time.Now().UTC()
+	name := fmt.Sprintf("%s-%s.jsonl", prefix, opened.Format("20060102T150405.000000000Z"))
+	if captureCfg.Compress {
+		name += ".gz"
+	}
+	path := filepath.Join(captureCfg.Dir, name)
+	file, err := os.Create(path + partSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+	captured := &captureFile{path: path, opened: opened, file: file}
+	var w io.Writer = file
+	if captureCfg.Compress {
+		captured.gzip = gzip.NewWriter(file)
+		w = captured.gzip
+	}
+	captured.buf = bufio.NewWriter(w)
+	return captured, nil
+}
+
+// full reports whether the file should be rotated before writing size more bytes.
+func (f *captureFile) full(size int64, captureCfg cfg.CaptureConfig) bool {
+	if f.written > 0 && f.written+size > captureCfg.MaxFileBytes {
+		return true
+	}
+	return captureCfg.MaxFileAge > 0 && time.Since(f.opened) >= captureCfg.MaxFileAge
+}
+
+func (f *captureFile) Write(p []byte) (int, error) {
+	n, err := f.buf.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+// Close flushes the file and moves it to its final path.
+func (f *captureFile) Close() error {
+	err := f.buf.Flush()
+	if f.gzip != nil {
+		err = errors.Join(err, f.gzip.Close())
+	}
+	err = errors.Join(err, f.file.Close())
+	if err != nil {
+		return fmt.Errorf("failed to close capture file %s: %w", f.path, err)
+	}
+	if err = os.Rename(f.path+partSuffix, f.path); err != nil {
+		return fmt.Errorf("failed to complete capture file %s: %w", f.path, err)
+	}
+	return nil
+}
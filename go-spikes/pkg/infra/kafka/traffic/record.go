@@ -0,0 +1,64 @@
+package traffic
+
+import (
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Header is a message header. Its value is base64 encoded in JSON, as it may be binary.
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Record is a captured message, one line of a capture file. Key and Value are base64
+// encoded in JSON, as messages may be binary; a null Value is a tombstone.
+type Record struct {
+	Topic     string    `json:"topic,omitempty"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+	Key       []byte    `json:"key"`
+	Value     []byte    `json:"value"`
+	Headers   []Header  `json:"headers,omitempty"`
+}
+
+func newRecord(msg *k.Message) Record {
+	record := Record{
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Timestamp: msg.Timestamp,
+		Key:       msg.Key,
+		Value:     msg.Value,
+	}
+	if msg.TopicPartition.Topic != nil {
+		record.Topic = *msg.TopicPartition.Topic
+	}
+	for _, header := range msg.Headers {
+		record.Headers = append(record.Headers, Header{Key: header.Key, Value: header.Value})
+	}
+	return record
+}
+
+// MessageKey replays the recorded key, so that records keep their partitioning; a
+// record without a key is produced without one.
+func (r Record) MessageKey() []byte {
+	return r.Key
+}
+
+func (r Record) MessageValue() []byte {
+	return r.Value
+}
+
+func (r Record) IsTombstone() bool {
+	return r.Value == nil
+}
+
+func (r Record) MessageHeaders() []k.Header {
+	headers := make([]k.Header, len(r.Headers))
+	for i, header := range r.Headers {
+		headers[i] = k.Header{Key: header.Key, Value: header.Value}
+	}
+	return headers
+}
@@ -0,0 +1,299 @@
+package traffic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/infra-bed/go-spikes/pkg/config"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	infra "github.com/infra-bed/go-spikes/pkg/infra/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+)
+
+// ReplayStats counts what a replay job has sent:
+// * Files - the files replayed, in order
+// * Read - records read from the files
+// * Produced - records acknowledged by Kafka
+type ReplayStats struct {
+	Files    []string `json:"files"`
+	Read     int64    `json:"read"`
+	Produced int64    `json:"produced"`
+}
+
+// ReplayPlugin produces the records of capture files, or of a CSV, in file order, paced
+// by their recorded timestamps.
+type ReplayPlugin struct {
+	replayCfg    cfg.ReplayConfig
+	files        []string
+	logBatchSize int
+	// mu guards the stats, which are updated by the generator and the delivery handler
+	mu    sync.Mutex
+	stats ReplayStats
+}
+
+func NewReplayPlugin(replayCfg cfg.ReplayConfig) (*ReplayPlugin, error) {
+	switch replayCfg.Format {
+	case "":
+		replayCfg.Format = cfg.ReplayJSONL
+	case cfg.ReplayJSONL, cfg.ReplayCSV:
+	default:
+		return nil, fmt.Errorf("unknown replay format %q", replayCfg.Format)
+	}
+	switch replayCfg.Timing {
+	case "":
+		replayCfg.Timing = cfg.ReplayOriginal
+	case cfg.ReplayOriginal, cfg.ReplayFast:
+	case cfg.ReplayScaled:
+		if replayCfg.Speed <= 0 {
+			return nil, fmt.Errorf("scaled replay needs a speed greater than zero")
+		}
+	default:
+		return nil, fmt.Errorf("unknown replay timing %q", replayCfg.Timing)
+	}
+	files, err := filepath.Glob(replayCfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay path %q: %w", replayCfg.Path, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no replay files match %q", replayCfg.Path)
+	}
+	sort.Strings(files)
+	logBatchSize := replayCfg.LogBatchSize
+	if logBatchSize <= 0 {
+		logBatchSize = config.DefaultLogBatchSize
+	}
+	return &ReplayPlugin{
+		replayCfg:    replayCfg,
+		files:        files,
+		logBatchSize: logBatchSize,
+		stats:        ReplayStats{Files: files},
+	}, nil
+}
+
+func (r *ReplayPlugin) GetName() string {
+	return r.replayCfg.JobName
+}
+
+func (r *ReplayPlugin) GetInitialDelayDuration() time.Duration {
+	return r.replayCfg.InitialDelayDuration
+}
+
+func (r *ReplayPlugin) GetRunDuration() time.Duration {
+	return r.replayCfg.RunDuration
+}
+
+func (r *ReplayPlugin) GetIntervalDuration() time.Duration {
+	return r.replayCfg.IntervalDuration
+}
+
+func (r *ReplayPlugin) GetResult() interface{} {
+	return r.Stats()
+}
+
+func (r *ReplayPlugin) Stats() ReplayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *ReplayPlugin) ProduceMessageListener(ctx context.Context, engine infra.ProducerJob[Record], msg *k.Message) error {
+	r.mu.Lock()
+	r.stats.Produced++
+	produced := r.stats.Produced
+	r.mu.Unlock()
+	if produced%int64(r.logBatchSize) == 0 {
+		logger.WithContext(ctx).Info().Int64("produced", produced).Msg("replayed records")
+	}
+	return nil
+}
+
+// Payloads reads the files one after the other. The first timestamped record is sent
+// straight away, and each later one once the time since its recording, scaled as
+// configured, has passed since then; records recorded earlier are sent without pause.
+func (r *ReplayPlugin) Payloads(ctx context.Context) (<-chan Record, error) {
+	log := logger.Ctx(ctx)
+	log.Info().
+		Any("files", r.files).
+		Str("timing", r.replayCfg.Timing).
+		Msg("Replaying records")
+	records := make(chan Record)
+
+	go func() {
+		defer close(records)
+		var first, started time.Time
+		for _, path := range r.files {
+			err := r.readFile(path, func(record Record) bool {
+				r.mu.Lock()
+				r.stats.Read++
+				r.mu.Unlock()
+				if r.replayCfg.Timing != cfg.ReplayFast && !record.Timestamp.IsZero() {
+					if first.IsZero() {
+						first, started = record.Timestamp, time.Now()
+					} else if !r.waitUntil(ctx, started.Add(r.scale(record.Timestamp.Sub(first)))) {
+						return false
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return false
+				case records <- record:
+					return true
+				}
+			})
+			if err != nil {
+				log.Error().Err(err).Str("file", path).Msg("Failed to replay file")
+			}
+			if ctx.Err() != nil {
+				log.Info().Msg("replay done")
+				return
+			}
+		}
+		log.Info().Any("stats", r.Stats()).Msg("Replayed every file")
+	}()
+	return records, nil
+}
+
+func (r *ReplayPlugin) scale(gap time.Duration) time.Duration {
+	if r.replayCfg.Timing == cfg.ReplayScaled {
+		return time.Duration(float64(gap) / r.replayCfg.Speed)
+	}
+	return gap
+}
+
+// waitUntil returns false if ctx is done first.
+func (r *ReplayPlugin) waitUntil(ctx context.Context, at time.Time) bool {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// readFile passes every record of the file to send until it returns false.
+func (r *ReplayPlugin) readFile(path string, send func(Record) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file: %w", err)
+	}
+	defer file.Close()
+	var reader io.Reader = bufio.NewReader(file)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to decompress replay file: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	if r.replayCfg.Format == cfg.ReplayCSV {
+		return readCSV(reader, send)
+	}
+	return readJSONL(reader, send)
+}
+
+func readJSONL(reader io.Reader, send func(Record) bool) error {
+	decoder := json.NewDecoder(reader)
+	for line := 1; ; line++ {
+		var record Record
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode record %d: %w", line, err)
+		}
+		if !send(record) {
+			return nil
+		}
+	}
+}
+
+// readCSV reads the columns its header row names: value, and optionally timestamp (RFC
+// 3339 or Unix milliseconds), key and headers (a JSON object of strings). An empty value
+// is a tombstone, and an empty key produces the record without one.
+func readCSV(reader io.Reader, send func(Record) bool) error {
+	rows := csv.NewReader(reader)
+	rows.FieldsPerRecord = -1
+	header, err := rows.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["value"]; !ok {
+		return fmt.Errorf("csv has no value column")
+	}
+	cell := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read csv line %d: %w", line, err)
+		}
+		var record Record
+		if value := cell(row, "value"); value != "" {
+			record.Value = []byte(value)
+		}
+		if key := cell(row, "key"); key != "" {
+			record.Key = []byte(key)
+		}
+		if record.Timestamp, err = parseTimestamp(cell(row, "timestamp")); err != nil {
+			return fmt.Errorf("invalid timestamp on csv line %d: %w", line, err)
+		}
+		if headers := cell(row, "headers"); headers != "" {
+			values := make(map[string]string)
+			if err = json.Unmarshal([]byte(headers), &values); err != nil {
+				return fmt.Errorf("invalid headers on csv line %d: %w", line, err)
+			}
+			for key, value := range values {
+				record.Headers = append(record.Headers, Header{Key: key, Value: []byte(value)})
+			}
+			sort.Slice(record.Headers, func(i, j int) bool {
+				return record.Headers[i].Key < record.Headers[j].Key
+			})
+		}
+		if !send(record) {
+			return nil
+		}
+	}
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
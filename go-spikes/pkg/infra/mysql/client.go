@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/infra-bed/go-spikes/pkg/config"
+)
+
+// DSN returns the data source name of mc, with the password of its secret file.
+func DSN(mc config.MySQLConfig) (string, error) {
+	password, err := mc.Password()
+	if err != nil {
+		return "", err
+	}
+	dsn := driver.NewConfig()
+	dsn.User = mc.User
+	dsn.Passwd = password
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(mc.Host, strconv.Itoa(mc.Port))
+	dsn.DBName = mc.Database
+	dsn.ParseTime = true
+	return dsn.FormatDSN(), nil
+}
+
+// NewClient opens a connection pool to database.mysql and checks it is reachable. The
+// pool opens up to MaxConnections, keeps MaxIdleConns open while idle, and replaces
+// connections older than ConnMaxLifetime.
+func NewClient(ctx context.Context, mc config.MySQLConfig) (*sql.DB, error) {
+	if !mc.Enabled {
+		return nil, fmt.Errorf("database.mysql is not enabled")
+	}
+	dsn, err := DSN(mc)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mysql: %w", err)
+	}
+	db.SetMaxOpenConns(mc.MaxConnections)
+	db.SetMaxIdleConns(mc.MaxIdleConns)
+	db.SetConnMaxLifetime(mc.ConnMaxLifetime)
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to reach mysql: %w", err)
+	}
+	return db, nil
+}
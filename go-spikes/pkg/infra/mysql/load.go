@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/infra-bed/go-spikes/pkg/config"
+	"github.com/infra-bed/go-spikes/pkg/infra/dbload"
+)
+
+// seedBatchSize is the rows inserted per statement while seeding
+const seedBatchSize = 500
+
+// NewLoadJob returns a load job on the table of loadCfg, on a new pool to database.mysql.
+func NewLoadJob(ctx context.Context, mc config.MySQLConfig, loadCfg config.LoadConfig) (*dbload.Job, error) {
+	db, err := NewClient(ctx, mc)
+	if err != nil {
+		return nil, err
+	}
+	job, err := dbload.NewJob("mysql", "", &loadTable{db: db, name: loadCfg.Table}, loadCfg)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return job, nil
+}
+
+type loadTable struct {
+	db   *sql.DB
+	name string
+}
+
+func (t *loadTable) Prepare(ctx context.Context, rows int, payload func() string) (int64, error) {
+	if _, err := t.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	category BIGINT NOT NULL,
+	payload TEXT NOT NULL,
+	counter BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP(6) NOT NULL,
+	INDEX %s_category (category)
+)`, t.name, t.name)); err != nil {
+		return 0, fmt.Errorf("failed to create load table %s: %w", t.name, err)
+	}
+	var count int
+	if err := t.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", t.name)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows of %s: %w", t.name, err)
+	}
+	for count < rows {
+		batch := min(seedBatchSize, rows-count)
+		args := make([]interface{}, 0, batch*3)
+		for i := 0; i < batch; i++ {
+			args = append(args, int64(count+i)%100, payload(), time.Now().UTC())
+		}
+		query := fmt.Sprintf("INSERT INTO %s (category, payload, updated_at) VALUES %s",
+			t.name, strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", batch), ", "))
+		if _, err := t.db.ExecContext(ctx, query, args...); err != nil {
+			return 0, fmt.Errorf("failed to seed %s: %w", t.name, err)
+		}
+		count += batch
+	}
+	var maxID int64
+	if err := t.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s", t.name)).Scan(&maxID); err != nil {
+		return 0, fmt.Errorf("failed to read the highest id of %s: %w", t.name, err)
+	}
+	return maxID, nil
+}
+
+func (t *loadTable) Read(ctx context.Context, id int64) (bool, error) {
+	var category, counter int64
+	var payload string
+	err := t.db.QueryRowContext(ctx, fmt.Sprintf("SELECT category, payload, counter FROM %s WHERE id = ?", t.name), id).
+		Scan(&category, &payload, &counter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *loadTable) Insert(ctx context.Context, category int64, payload string) (int64, error) {
+	result, err := t.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (category, payload, updated_at) VALUES (?, ?, ?)", t.name),
+		category, payload, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (t *loadTable) Update(ctx context.Context, id int64, payload string) (bool, error) {
+	return t.affected(t.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET payload = ?, counter = counter + 1, updated_at = ? WHERE id = ?", t.name),
+		payload, time.Now().UTC(), id))
+}
+
+func (t *loadTable) Delete(ctx context.Context, id int64) (bool, error) {
+	return t.affected(t.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", t.name), id))
+}
+
+func (t *loadTable) affected(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (t *loadTable) PoolStats() dbload.PoolStats {
+	stats := t.db.Stats()
+	return dbload.PoolStats{
+		MaxOpen:      stats.MaxOpenConnections,
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
+}
+
+func (t *loadTable) Close() {
+	_ = t.db.Close()
+}
@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/infra-bed/go-spikes/pkg/config"
+	"github.com/infra-bed/go-spikes/pkg/infra/dbload"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// seedBatchSize is the rows copied per COPY while seeding
+const seedBatchSize = 5000
+
+// NewLoadJob returns a load job on the table of loadCfg, on a new pool to database.postgres
+// through target, so the direct service and the pooler can be compared.
+func NewLoadJob(ctx context.Context, pc config.PostgresConfig, loadCfg config.LoadConfig, target string) (*dbload.Job, error) {
+	if target == "" {
+		target = TargetDirect
+	}
+	pc, err := ForTarget(pc, target)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := NewPool(ctx, pc)
+	if err != nil {
+		return nil, err
+	}
+	job, err := dbload.NewJob("postgres", target, &loadTable{pool: pool, name: loadCfg.Table}, loadCfg)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return job, nil
+}
+
+type loadTable struct {
+	pool *pgxpool.Pool
+	name string
+}
+
+func (t *loadTable) Prepare(ctx context.Context, rows int, payload func() string) (int64, error) {
+	if _, err := t.pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	category BIGINT NOT NULL,
+	payload TEXT NOT NULL,
+	counter BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL
+)`, t.name)); err != nil {
+		return 0, fmt.Errorf("failed to create load table %s: %w", t.name, err)
+	}
+	if _, err := t.pool.Exec(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_category ON %s (category)", t.name, t.name)); err != nil {
+		return 0, fmt.Errorf("failed to index load table %s: %w", t.name, err)
+	}
+	var count int
+	if err := t.pool.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", t.name)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows of %s: %w", t.name, err)
+	}
+	for count < rows {
+		batch := min(seedBatchSize, rows-count)
+		seed := make([][]interface{}, 0, batch)
+		for i := 0; i < batch; i++ {
+			seed = append(seed, []interface{}{int64(count+i) % 100, payload(), time.Now().UTC()})
+		}
+		if _, err := t.pool.CopyFrom(ctx, pgx.Identifier{t.name}, []string{"category", "payload", "updated_at"},
+			pgx.CopyFromRows(seed)); err != nil {
+			return 0, fmt.Errorf("failed to seed %s: %w", t.name, err)
+		}
+		count += batch
+	}
+	var maxID int64
+	if err := t.pool.QueryRow(ctx, fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s", t.name)).Scan(&maxID); err != nil {
+		return 0, fmt.Errorf("failed to read the highest id of %s: %w", t.name, err)
+	}
+	return maxID, nil
+}
+
+func (t *loadTable) Read(ctx context.Context, id int64) (bool, error) {
+	var category, counter int64
+	var payload string
+	err := t.pool.QueryRow(ctx, fmt.Sprintf("SELECT category, payload, counter FROM %s WHERE id = $1", t.name), id).
+		Scan(&category, &payload, &counter)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *loadTable) Insert(ctx context.Context, category int64, payload string) (int64, error) {
+	var id int64
+	err := t.pool.QueryRow(ctx, fmt.Sprintf(
+		"INSERT INTO %s (category, payload, updated_at) VALUES ($1, $2, $3) RETURNING id", t.name),
+		category, payload, time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+func (t *loadTable) Update(ctx context.Context, id int64, payload string) (bool, error) {
+	return t.affected(t.pool.Exec(ctx, fmt.Sprintf(
+		"UPDATE %s SET payload = $1, counter = counter + 1, updated_at = $2 WHERE id = $3", t.name),
+		payload, time.Now().UTC(), id))
+}
+
+func (t *loadTable) Delete(ctx context.Context, id int64) (bool, error) {
+	return t.affected(t.pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", t.name), id))
+}
+
+func (t *loadTable) affected(tag pgconn.CommandTag, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PoolStats maps pgxpool's counters; it only tracks the time spent in all acquisitions,
+// so WaitDuration includes those that found an idle connection.
+func (t *loadTable) PoolStats() dbload.PoolStats {
+	stats := t.pool.Stat()
+	return dbload.PoolStats{
+		MaxOpen:      int(stats.MaxConns()),
+		Open:         int(stats.TotalConns()),
+		InUse:        int(stats.AcquiredConns()),
+		Idle:         int(stats.IdleConns()),
+		WaitCount:    stats.EmptyAcquireCount(),
+		WaitDuration: stats.AcquireDuration(),
+	}
+}
+
+func (t *loadTable) Close() {
+	t.pool.Close()
+}
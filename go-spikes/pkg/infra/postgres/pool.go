@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/infra-bed/go-spikes/pkg/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Targets of database.postgres: the cluster's -rw service at Host and Port, or the
+// PgBouncer pooler in front of it at PoolerHost and PoolerPort.
+const (
+	TargetDirect = "direct"
+	TargetPooler = "pooler"
+)
+
+// ForTarget returns pc pointed at target; an empty target is the direct service.
+func ForTarget(pc config.PostgresConfig, target string) (config.PostgresConfig, error) {
+	switch target {
+	case "", TargetDirect:
+		return pc, nil
+	case TargetPooler:
+		if pc.PoolerHost == "" {
+			return pc, fmt.Errorf("database.postgres.poolerHost is not set")
+		}
+		pc.Host = pc.PoolerHost
+		if pc.PoolerPort > 0 {
+			pc.Port = pc.PoolerPort
+		}
+		return pc, nil
+	default:
+		return pc, fmt.Errorf("unknown postgres target %q, expected %q or %q", target, TargetDirect, TargetPooler)
+	}
+}
+
+// ConnString returns the connection URL of pc, with the password of its secret file.
+func ConnString(pc config.PostgresConfig) (string, error) {
+	password, err := pc.Password()
+	if err != nil {
+		return "", err
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(pc.User, password),
+		Host:     net.JoinHostPort(pc.Host, strconv.Itoa(pc.Port)),
+		Path:     "/" + pc.Database,
+		RawQuery: url.Values{"sslmode": []string{pc.SSLMode}}.Encode(),
+	}
+	return dsn.String(), nil
+}
+
+// NewPool connects a native pgx pool to database.postgres and checks it is reachable.
+// The pool opens up to MaxConnections, keeps MaxIdleConns open while idle, and replaces
+// connections older than ConnMaxLifetime.
+func NewPool(ctx context.Context, pc config.PostgresConfig) (*pgxpool.Pool, error) {
+	if !pc.Enabled {
+		return nil, fmt.Errorf("database.postgres is not enabled")
+	}
+	connString, err := ConnString(pc)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres config: %w", err)
+	}
+	if pc.MaxConnections > 0 {
+		poolConfig.MaxConns = int32(pc.MaxConnections)
+	}
+	poolConfig.MinConns = int32(min(pc.MaxIdleConns, int(poolConfig.MaxConns)))
+	if pc.ConnMaxLifetime > 0 {
+		poolConfig.MaxConnLifetime = pc.ConnMaxLifetime
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create postgres pool: %w", err)
+	}
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to reach postgres: %w", err)
+	}
+	return pool, nil
+}
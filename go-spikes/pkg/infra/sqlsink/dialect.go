@@ -0,0 +1,119 @@
+package sqlsink
+
+import (
+	"fmt"
+	"strings"
+
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+)
+
+// dialect builds the statements of the sink for one database.
+type dialect interface {
+	createTable(table string) string
+	// upsert inserts rows records, or updates the ones whose entity id already exists
+	// unless the stored row is newer, see Record.supersedes
+	upsert(table string, rows int) string
+	// deleteIn deletes rows records, keeping the rows that hold a later change of the
+	// same run
+	deleteIn(table string, rows int) string
+}
+
+func newDialect(database string) dialect {
+	if database == cfg.SinkPostgres {
+		return postgresDialect{}
+	}
+	return mysqlDialect{}
+}
+
+// recordColumns are the values of a record, in the order of upsert's placeholders.
+const recordColumns = 7
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) createTable(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	entity_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	payload JSON NOT NULL,
+	kafka_partition INT NOT NULL,
+	kafka_offset BIGINT NOT NULL,
+	producer_run VARCHAR(255) NOT NULL,
+	entity_sequence BIGINT NOT NULL,
+	updated_at TIMESTAMP(6) NOT NULL
+)`, table)
+}
+
+// mysqlNewer guards each assignment of the upsert, as MySQL has no WHERE on it. The
+// assignments run in order and see the columns already updated, so producer_run is
+// updated last for the guard to see the stored run throughout.
+const mysqlNewer = "producer_run <> new.producer_run OR entity_sequence <= new.entity_sequence"
+
+func (mysqlDialect) upsert(table string, rows int) string {
+	assignments := make([]string, 0, recordColumns-1)
+	for _, column := range []string{"payload", "kafka_partition", "kafka_offset", "updated_at", "entity_sequence", "producer_run"} {
+		assignments = append(assignments, fmt.Sprintf("%[1]s = IF(%[2]s, new.%[1]s, %[1]s)", column, mysqlNewer))
+	}
+	return fmt.Sprintf(`INSERT INTO %s (entity_id, payload, kafka_partition, kafka_offset, producer_run, entity_sequence, updated_at)
+VALUES %s AS new
+ON DUPLICATE KEY UPDATE %s`,
+		table, placeholderRows(rows, func(int) string { return "?" }), strings.Join(assignments, ",\n\t"))
+}
+
+func (mysqlDialect) deleteIn(table string, rows int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", table, deleteConditions(rows, func(int) string { return "?" }))
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) createTable(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	entity_id TEXT PRIMARY KEY,
+	payload JSONB NOT NULL,
+	kafka_partition INTEGER NOT NULL,
+	kafka_offset BIGINT NOT NULL,
+	producer_run TEXT NOT NULL,
+	entity_sequence BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`, table)
+}
+
+func (postgresDialect) upsert(table string, rows int) string {
+	return fmt.Sprintf(`INSERT INTO %[1]s (entity_id, payload, kafka_partition, kafka_offset, producer_run, entity_sequence, updated_at)
+VALUES %[2]s
+ON CONFLICT (entity_id) DO UPDATE SET payload = EXCLUDED.payload, kafka_partition = EXCLUDED.kafka_partition,
+	kafka_offset = EXCLUDED.kafka_offset, producer_run = EXCLUDED.producer_run,
+	entity_sequence = EXCLUDED.entity_sequence, updated_at = EXCLUDED.updated_at
+WHERE %[1]s.producer_run <> EXCLUDED.producer_run OR %[1]s.entity_sequence <= EXCLUDED.entity_sequence`,
+		table, placeholderRows(rows, func(i int) string { return fmt.Sprintf("$%d", i) }))
+}
+
+func (postgresDialect) deleteIn(table string, rows int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s",
+		table, deleteConditions(rows, func(i int) string { return fmt.Sprintf("$%d", i) }))
+}
+
+// deleteColumns are the values of a deleted record, in the order of deleteIn's placeholders.
+const deleteColumns = 3
+
+// deleteConditions renders the guarded conditions of rows deleted records, numbered from 1.
+func deleteConditions(rows int, placeholder func(i int) string) string {
+	conditions := make([]string, rows)
+	for row := range conditions {
+		i := row*deleteColumns + 1
+		conditions[row] = fmt.Sprintf("(entity_id = %s AND NOT (producer_run = %s AND entity_sequence > %s))",
+			placeholder(i), placeholder(i+1), placeholder(i+2))
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// placeholderRows renders rows tuples of recordColumns placeholders, numbered from 1.
+func placeholderRows(rows int, placeholder func(i int) string) string {
+	tuples := make([]string, rows)
+	for row := range tuples {
+		values := make([]string, recordColumns)
+		for column := range values {
+			values[column] = placeholder(row*recordColumns + column + 1)
+		}
+		tuples[row] = "(" + strings.Join(values, ", ") + ")"
+	}
+	return strings.Join(tuples, ", ")
+}
@@ -0,0 +1,67 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/infra-bed/go-spikes/pkg/config"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/infra/mysql"
+	"github.com/infra-bed/go-spikes/pkg/infra/postgres"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// open creates the connection pool of the sink's database and checks it is reachable.
+func open(ctx context.Context, database string, dbConfig config.DatabaseConfig) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	switch {
+	case database == cfg.SinkMySQL && dbConfig.MySQL.Enabled:
+		db, err = openMySQL(dbConfig.MySQL)
+	case database == cfg.SinkPostgres && dbConfig.Postgres.Enabled:
+		db, err = openPostgres(dbConfig.Postgres)
+	case database == cfg.SinkMySQL, database == cfg.SinkPostgres:
+		return nil, fmt.Errorf("database.%s is not enabled", database)
+	default:
+		return nil, fmt.Errorf("unknown sink database %q", database)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to reach %s: %w", database, err)
+	}
+	return db, nil
+}
+
+func openMySQL(mc config.MySQLConfig) (*sql.DB, error) {
+	dsn, err := mysql.DSN(mc)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mysql: %w", err)
+	}
+	db.SetMaxOpenConns(mc.MaxConnections)
+	db.SetMaxIdleConns(mc.MaxIdleConns)
+	db.SetConnMaxLifetime(mc.ConnMaxLifetime)
+	return db, nil
+}
+
+func openPostgres(pc config.PostgresConfig) (*sql.DB, error) {
+	dsn, err := postgres.ConnString(pc)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	db.SetMaxOpenConns(pc.MaxConnections)
+	db.SetMaxIdleConns(pc.MaxIdleConns)
+	db.SetConnMaxLifetime(pc.ConnMaxLifetime)
+	return db, nil
+}
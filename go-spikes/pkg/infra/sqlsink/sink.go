@@ -0,0 +1,259 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/infra-bed/go-spikes/pkg/config"
+	cfg "github.com/infra-bed/go-spikes/pkg/config/kafka"
+	"github.com/infra-bed/go-spikes/pkg/logger"
+	"github.com/infra-bed/go-spikes/pkg/metrics"
+	"github.com/infra-bed/go-spikes/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultRetryBackoff = 100 * time.Millisecond
+	// maxRowsPerStatement keeps statements below the placeholder limit of both databases
+	maxRowsPerStatement = 1000
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Record is a consumed change of an entity; a nil Value deletes the entity.
+type Record struct {
+	EntityID  string
+	Value     []byte
+	Partition int32
+	Offset    int64
+	// RunID and Sequence order the changes of an entity, as a redelivered record may
+	// arrive after a newer one
+	RunID    string
+	Sequence int64
+	// Timestamp is the message timestamp, from which the end-to-end latency is measured
+	Timestamp time.Time
+}
+
+// supersedes reports whether r replaces other. Sequences only compare within a run, so a
+// record of another run always does.
+func (r Record) supersedes(other Record) bool {
+	return r.RunID != other.RunID || r.Sequence >= other.Sequence
+}
+
+// Stats counts what a sink has written:
+// * Flushes - committed transactions
+// * Upserts and Deletes - rows written, after keeping the last record of each entity
+// * Retries - failed transactions that were attempted again
+// * Failures - writes that failed every attempt
+type Stats struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Flushes  int64  `json:"flushes"`
+	Upserts  int64  `json:"upserts"`
+	Deletes  int64  `json:"deletes"`
+	Retries  int64  `json:"retries"`
+	Failures int64  `json:"failures"`
+}
+
+// Sink writes consumed records to a database table keyed by entity id. Writes are
+// idempotent, so records consumed again after a failure leave the same rows.
+type Sink interface {
+	// Write applies the records in one transaction, retrying it as configured. The caller
+	// must only commit the records' offsets once Write has returned nil.
+	Write(ctx context.Context, records []Record) error
+	Stats() Stats
+	Close() error
+}
+
+type sqlSink struct {
+	config  cfg.SQLSinkConfig
+	db      *sql.DB
+	dialect dialect
+
+	flushes  atomic.Int64
+	upserts  atomic.Int64
+	deletes  atomic.Int64
+	retries  atomic.Int64
+	failures atomic.Int64
+}
+
+// New connects to the configured database and creates the sink's table if it is missing.
+func New(ctx context.Context, sinkConfig cfg.SQLSinkConfig, dbConfig config.DatabaseConfig) (Sink, error) {
+	if err := sinkConfig.Validate(); err != nil {
+		return nil, err
+	}
+	if !tableName.MatchString(sinkConfig.Table) {
+		return nil, fmt.Errorf("invalid sink table name %q", sinkConfig.Table)
+	}
+	if sinkConfig.RetryBackoff <= 0 {
+		sinkConfig.RetryBackoff = defaultRetryBackoff
+	}
+	db, err := open(ctx, sinkConfig.Database, dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	sink := &sqlSink{
+		config:  sinkConfig,
+		db:      db,
+		dialect: newDialect(sinkConfig.Database),
+	}
+	if _, err = db.ExecContext(ctx, sink.dialect.createTable(sinkConfig.Table)); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create sink table %s: %w", sinkConfig.Table, err)
+	}
+	return sink, nil
+}
+
+func (s *sqlSink) Write(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ctx, span := tracing.StartSpanWithAttributes(
+		ctx,
+		"sql.sink.write",
+		tracing.DatabaseAttributes(s.config.Database, s.config.Table, "upsert"),
+	)
+	defer span.End()
+	tracing.SetSpanAttributes(span, attribute.Int("db.sink.record_count", len(records)))
+
+	upserts, deletes := latestPerEntity(records)
+	backoff := s.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.write(ctx, upserts, deletes)
+		if err == nil {
+			break
+		}
+		if attempt >= s.config.MaxRetries || ctx.Err() != nil {
+			s.failures.Add(1)
+			tracing.RecordError(span, err, "Failed to write records")
+			return fmt.Errorf("failed to write %d records after %d attempts: %w", len(records), attempt+1, err)
+		}
+		s.retries.Add(1)
+		logger.Ctx(ctx).Warn().
+			Err(err).
+			Int("attempt", attempt+1).
+			Dur("backoff", backoff).
+			Msg("Failed to write records, retrying")
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	committed := time.Now()
+	for _, record := range records {
+		if !record.Timestamp.IsZero() {
+			metrics.DatabaseSinkLatency.WithLabelValues(s.config.Database).Observe(committed.Sub(record.Timestamp).Seconds())
+		}
+	}
+	s.flushes.Add(1)
+	s.upserts.Add(int64(len(upserts)))
+	s.deletes.Add(int64(len(deletes)))
+	return nil
+}
+
+// latestPerEntity keeps the last record of each entity, as a statement may not touch a
+// row twice, and splits them into upserts and deletes.
+func latestPerEntity(records []Record) ([]Record, []Record) {
+	latest := make(map[string]int, len(records))
+	for i, record := range records {
+		if current, ok := latest[record.EntityID]; !ok || record.supersedes(records[current]) {
+			latest[record.EntityID] = i
+		}
+	}
+	var upserts []Record
+	var deletes []Record
+	for i, record := range records {
+		if latest[record.EntityID] != i {
+			continue
+		}
+		if record.Value == nil {
+			deletes = append(deletes, record)
+		} else {
+			upserts = append(upserts, record)
+		}
+	}
+	return upserts, deletes
+}
+
+func (s *sqlSink) write(ctx context.Context, upserts, deletes []Record) (err error) {
+	defer metrics.DatabaseConnections.WithLabelValues(s.config.Database).Set(float64(s.db.Stats().OpenConnections))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for start := 0; start < len(deletes); start += maxRowsPerStatement {
+		rows := deletes[start:min(start+maxRowsPerStatement, len(deletes))]
+		args := make([]interface{}, 0, len(rows)*deleteColumns)
+		for _, row := range rows {
+			args = append(args, row.EntityID, row.RunID, row.Sequence)
+		}
+		if err = s.exec(ctx, tx, "delete", s.dialect.deleteIn(s.config.Table, len(rows)), args); err != nil {
+			return err
+		}
+	}
+	for start := 0; start < len(upserts); start += maxRowsPerStatement {
+		rows := upserts[start:min(start+maxRowsPerStatement, len(upserts))]
+		args := make([]interface{}, 0, len(rows)*recordColumns)
+		for _, row := range rows {
+			args = append(args, row.EntityID, string(row.Value), row.Partition, row.Offset, row.RunID, row.Sequence, time.Now().UTC())
+		}
+		if err = s.exec(ctx, tx, "upsert", s.dialect.upsert(s.config.Table, len(rows)), args); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	err = tx.Commit()
+	s.observe("commit", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlSink) exec(ctx context.Context, tx *sql.Tx, operation, query string, args []interface{}) error {
+	start := time.Now()
+	_, err := tx.ExecContext(ctx, query, args...)
+	s.observe(operation, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to %s records: %w", operation, err)
+	}
+	return nil
+}
+
+func (s *sqlSink) observe(operation string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.DatabaseOperations.WithLabelValues(s.config.Database, operation, status).Inc()
+	metrics.DatabaseOperationDuration.WithLabelValues(s.config.Database, operation).Observe(time.Since(start).Seconds())
+}
+
+func (s *sqlSink) Stats() Stats {
+	return Stats{
+		Database: s.config.Database,
+		Table:    s.config.Table,
+		Flushes:  s.flushes.Load(),
+		Upserts:  s.upserts.Load(),
+		Deletes:  s.deletes.Load(),
+		Retries:  s.retries.Load(),
+		Failures: s.failures.Load(),
+	}
+}
+
+func (s *sqlSink) Close() error {
+	return s.db.Close()
+}
@@ -100,6 +100,90 @@ var (
 		[]string{"topic", "direction"}, // direction: "produce" or "consume"
 	)
 
+	KafkaBytesConsumed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_kafka_bytes_consumed_total",
+			Help: "Total number of Kafka message value bytes consumed",
+		},
+		[]string{"topic", "partition"},
+	)
+
+	KafkaMessageProcessingDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_spikes_kafka_message_processing_duration_seconds",
+			Help:    "Duration of handling a consumed Kafka message in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+		},
+		[]string{"topic"},
+	)
+
+	KafkaSimulatedStalls = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_kafka_simulated_stalls_total",
+			Help: "Total number of simulated processing stalls in Kafka consumer plugins",
+		},
+		[]string{"job"},
+	)
+
+	KafkaPollIdleSeconds = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_kafka_poll_idle_seconds_total",
+			Help: "Total time Kafka consumers spent in polls that returned no message",
+		},
+		[]string{"topic", "group"},
+	)
+
+	KafkaConsumeBatchSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_spikes_kafka_consume_batch_size",
+			Help:    "Number of messages in each consumed batch",
+			Buckets: []float64{1, 10, 50, 100, 250, 500, 1000, 5000},
+		},
+		[]string{"topic"},
+	)
+
+	KafkaConsumeBatchDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_spikes_kafka_consume_batch_duration_seconds",
+			Help:    "Duration of handling a consumed batch in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+		},
+		[]string{"topic"},
+	)
+
+	KafkaCommitLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_spikes_kafka_commit_latency_seconds",
+			Help:    "Latency of Kafka offset commits in seconds",
+			Buckets: []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.5, 1},
+		},
+		[]string{"topic", "strategy"},
+	)
+
+	KafkaCommitErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_kafka_commit_errors_total",
+			Help: "Total number of failed Kafka offset commits",
+		},
+		[]string{"topic", "strategy"},
+	)
+
+	KafkaRejectedMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_kafka_rejected_messages_total",
+			Help: "Total number of rejected Kafka messages sent to a retry topic or DLQ",
+		},
+		[]string{"topic", "destination"},
+	)
+
+	KafkaDeadLetterReplayed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_kafka_dead_letter_replayed_total",
+			Help: "Total number of DLQ messages replayed to their original topic",
+		},
+		[]string{"topic"},
+	)
+
 	KafkaPartitionLag = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "go_spikes_kafka_partition_lag",
@@ -151,6 +235,32 @@ var (
 		[]string{"database_type", "operation"},
 	)
 
+	DatabaseSinkLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_spikes_database_sink_latency_seconds",
+			Help:    "Time from a consumed record's Kafka timestamp to its database commit",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"database_type"},
+	)
+
+	OutboxRelayLag = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_spikes_outbox_relay_lag_seconds",
+			Help:    "Time from an outbox event's insert to its acknowledged publish to Kafka",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"mode"}, // poll, notify
+	)
+
+	OutboxRelayKills = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_spikes_outbox_relay_kills_total",
+			Help: "Total number of outbox relays killed by the outbox spike",
+		},
+		[]string{"job_name"},
+	)
+
 	// Application health metrics
 	ApplicationInfo = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -2,6 +2,7 @@ package model
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -9,20 +10,44 @@ import (
 	"github.com/infra-bed/go-spikes/pkg/logger"
 )
 
+// maxFinishedExecutions bounds how many finished executions are kept for their results.
+const maxFinishedExecutions = 100
+
 type ExecutionRepoManager interface {
 	Add(job Job, cancelFunc context.CancelFunc) string
 	List() []string
+	ListExecutions() []JobExecution
+	Get(id string) (JobExecution, bool)
 	Close(id string)
 }
 
+// JobExecution is a snapshot of a running or finished job.
+type JobExecution struct {
+	ID        string     `json:"id"`
+	JobName   string     `json:"jobName"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	Running   bool       `json:"running"`
+	Job       Job        `json:"-"`
+}
+
+// ResultReporter is implemented by jobs that summarise their execution. The result is
+// read while the job is running as well as after it has finished, so it must be safe
+// for concurrent use.
+type ResultReporter interface {
+	GetResult() interface{}
+}
+
 var ExecutionRepo ExecutionRepoManager = &executionRepo{
-	runningJobs: make(map[string]*jobExecutionImpl),
-	mutex:       sync.RWMutex{},
+	runningJobs:  make(map[string]*jobExecutionImpl),
+	finishedJobs: make(map[string]*jobExecutionImpl),
+	mutex:        sync.RWMutex{},
 }
 
 type executionRepo struct {
-	runningJobs map[string]*jobExecutionImpl
-	mutex       sync.RWMutex
+	runningJobs  map[string]*jobExecutionImpl
+	finishedJobs map[string]*jobExecutionImpl
+	mutex        sync.RWMutex
 }
 
 func (e *executionRepo) Add(job Job, cancelFunc context.CancelFunc) string {
@@ -44,13 +69,47 @@ func (e *executionRepo) List() []string {
 	return execIds
 }
 
+// ListExecutions returns running and finished executions, oldest first.
+func (e *executionRepo) ListExecutions() []JobExecution {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	var executions []JobExecution
+	for _, exec := range e.runningJobs {
+		executions = append(executions, exec.snapshot())
+	}
+	for _, exec := range e.finishedJobs {
+		executions = append(executions, exec.snapshot())
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartTime.Before(executions[j].StartTime)
+	})
+	return executions
+}
+
+func (e *executionRepo) Get(id string) (JobExecution, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if exec, exists := e.runningJobs[id]; exists {
+		return exec.snapshot(), true
+	}
+	if exec, exists := e.finishedJobs[id]; exists {
+		return exec.snapshot(), true
+	}
+	return JobExecution{}, false
+}
+
 func (e *executionRepo) Close(id string) {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
-	if _, exists := e.runningJobs[id]; exists {
-		e.runningJobs[id].cancel()
+	if exec, exists := e.runningJobs[id]; exists {
+		exec.cancel()
+		exec.endTime = time.Now()
 		delete(e.runningJobs, id)
+		e.finishedJobs[id] = exec
+		e.evictFinished()
 	} else {
 		logger.Get().Warn().
 			Str("id", id).
@@ -58,11 +117,25 @@ func (e *executionRepo) Close(id string) {
 	}
 }
 
+// evictFinished drops the oldest finished executions beyond maxFinishedExecutions.
+func (e *executionRepo) evictFinished() {
+	for len(e.finishedJobs) > maxFinishedExecutions {
+		var oldest *jobExecutionImpl
+		for _, exec := range e.finishedJobs {
+			if oldest == nil || exec.endTime.Before(oldest.endTime) {
+				oldest = exec
+			}
+		}
+		delete(e.finishedJobs, oldest.id)
+	}
+}
+
 func newJobExecution(job Job, cancelFunc context.CancelFunc) *jobExecutionImpl {
 	return &jobExecutionImpl{
 		id:        uuid.New().String(),
 		startTime: time.Now(),
 		jobName:   job.GetPlugin().GetName(),
+		job:       job,
 		cancel:    cancelFunc,
 	}
 }
@@ -71,5 +144,22 @@ type jobExecutionImpl struct {
 	id        string
 	jobName   string
 	startTime time.Time
+	endTime   time.Time
+	job       Job
 	cancel    context.CancelFunc
 }
+
+func (j *jobExecutionImpl) snapshot() JobExecution {
+	execution := JobExecution{
+		ID:        j.id,
+		JobName:   j.jobName,
+		StartTime: j.startTime,
+		Running:   j.endTime.IsZero(),
+		Job:       j.job,
+	}
+	if !j.endTime.IsZero() {
+		endTime := j.endTime
+		execution.EndTime = &endTime
+	}
+	return execution
+}
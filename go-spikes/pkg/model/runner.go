@@ -2,6 +2,7 @@ package model
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/infra-bed/go-spikes/pkg/logger"
@@ -10,7 +11,10 @@ import (
 )
 
 type Runner interface {
-	Start(ctx context.Context, job Job)
+	// Start runs the job in the background and returns its execution id.
+	Start(ctx context.Context, job Job) string
+	// Wait blocks until every job started by this Runner has returned from Run.
+	Wait()
 }
 
 func NewRunner() Runner {
@@ -22,9 +26,10 @@ func NewRunner() Runner {
 
 type runnerImpl struct {
 	tracer trace.Tracer
+	wg     sync.WaitGroup
 }
 
-func (r *runnerImpl) Start(ctx context.Context, job Job) {
+func (r *runnerImpl) Start(ctx context.Context, job Job) string {
 	if job.GetPlugin().GetRunDuration() <= 0 {
 		logger.Ctx(ctx).Error().
 			Str("job-name", job.GetPlugin().GetName()).
@@ -49,12 +54,19 @@ func (r *runnerImpl) Start(ctx context.Context, job Job) {
 	ctx, cancel = context.WithTimeout(ctx, job.GetPlugin().GetRunDuration())
 	ctx, span = r.tracer.Start(ctx, job.GetPlugin().GetName())
 	execId := ExecutionRepo.Add(job, cancel)
+	r.wg.Add(1)
 	go func(ctx context.Context) {
+		defer r.wg.Done()
 		defer span.End()
 		defer cancel()
 		defer ExecutionRepo.Close(execId)
 		job.Run(ctx)
 	}(ctx)
+	return execId
+}
+
+func (r *runnerImpl) Wait() {
+	r.wg.Wait()
 }
 
 func delayTimer(duration time.Duration) <-chan time.Time {